@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	dst = flag.String("dst", "", "Destination path on the remote storage to store the backup at. "+
+		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir or fs:///path/to/local/backup/dir")
+	storageDataPath       = flag.String("storageDataPath", "victoria-metrics-data", "Path to VictoriaMetrics data. Must match -storageDataPath used when starting VictoriaMetrics")
+	concurrency           = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce backup duration")
+	httpListenAddr        = flag.String("httpListenAddr", "", "Address to listen for http connections exposing /metrics and /-/status. Leave empty to disable")
+	notifyURL             = flag.String("notifyURL", "", "URL to POST a JSON status payload to once the backup finishes, e.g. for Kubernetes operators or CI to react without tailing logs")
+	minFreeDiskSpaceBytes = flag.Int64("storageDataPath.minFreeDiskSpaceBytes", 0, "The minimum free disk space at -storageDataPath to keep for the duration of the backup. 0 means the library default (1GiB) is used. Only writes made through lib/fs check it; the backup's own file IO doesn't go through lib/fs")
+	ioConcurrency         = flag.Int("storageDataPath.ioConcurrency", 0, "The maximum number of concurrent IO operations allowed against -storageDataPath's underlying device. "+
+		"1 serializes all IO into a single queue, which can roughly double throughput on HDD-backed mounts under concurrent access. 0 (default) applies no limit. "+
+		"Only IO made through lib/fs is limited; the backup's own file IO doesn't go through lib/fs")
+
+	retentionKeepLastBackups    = flag.Int("retention.keepLastBackups", 0, "Number of most recent backups to keep regardless of age. Retention pruning runs only if at least one of -retention.keep* flags is positive")
+	retentionKeepDailyBackups   = flag.Int("retention.keepDailyBackups", 0, "Number of days for which one daily backup is kept. 0 means daily backups aren't kept")
+	retentionKeepWeeklyBackups  = flag.Int("retention.keepWeeklyBackups", 0, "Number of weeks for which one weekly backup is kept. 0 means weekly backups aren't kept")
+	retentionKeepMonthlyBackups = flag.Int("retention.keepMonthlyBackups", 0, "Number of months for which one monthly backup is kept. 0 means monthly backups aren't kept")
+	retentionMaxTotalBytes      = flag.Int64("retention.maxTotalBytes", 0, "Maximum total size in bytes of the surviving backups after pruning. 0 means no cap")
+	retentionMinPartsThreshold  = flag.Int("retention.minPartsThreshold", 0, "Refuse to prune if -dst has fewer parts than this; guards against pruning everything on a failed listing. 0 disables the guard")
+	retentionDryRun             = flag.Bool("retention.dryRun", false, "Whether to only log the backups that -retention.* flags would prune, without deleting anything")
+)
+
+var backupStatus = &status{}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	buildinfo.Init()
+
+	if len(*httpListenAddr) > 0 {
+		go httpserver.Serve(*httpListenAddr, requestHandler)
+	}
+
+	srcFS, err := newSrcFS()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	dstFS, err := newDstFS()
+	if err != nil {
+		logger.Fatalf("%s", err)
+	}
+	fs.RegisterReservation(*storageDataPath, uint64(*minFreeDiskSpaceBytes))
+	fs.SetIOConcurrency(*storageDataPath, *ioConcurrency)
+	a := &actions.Backup{
+		Concurrency: *concurrency,
+		Src:         srcFS,
+		Dst:         dstFS,
+		Progress: &actions.Progress{
+			OnStart: func(backupSize uint64) {
+				backupStatus.setRunning(backupSize)
+			},
+			OnPartDone: func(p common.Part, bytesTransferred uint64) {
+				backupStatus.addBytes(bytesTransferred)
+			},
+			OnFinish: func(stats actions.ProgressStats) {
+				backupStatus.setFinished(stats)
+				actions.Notify(*notifyURL, "backup", stats)
+			},
+		},
+	}
+	if err := a.Run(); err != nil {
+		logger.Fatalf("cannot create backup: %s", err)
+	}
+
+	if *retentionKeepLastBackups <= 0 && *retentionKeepDailyBackups <= 0 && *retentionKeepWeeklyBackups <= 0 && *retentionKeepMonthlyBackups <= 0 {
+		return
+	}
+	p := &actions.Prune{
+		Concurrency:       *concurrency,
+		Storage:           dstFS,
+		KeepLast:          *retentionKeepLastBackups,
+		KeepDaily:         *retentionKeepDailyBackups,
+		KeepWeekly:        *retentionKeepWeeklyBackups,
+		KeepMonthly:       *retentionKeepMonthlyBackups,
+		MaxTotalSize:      uint64(*retentionMaxTotalBytes),
+		MinPartsThreshold: *retentionMinPartsThreshold,
+		DryRun:            *retentionDryRun,
+	}
+	if err := p.Run(); err != nil {
+		logger.Fatalf("cannot prune old backups at %s: %s", dstFS, err)
+	}
+}
+
+func requestHandler(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case "/metrics":
+		metrics.WritePrometheus(w, true)
+		return true
+	case "/-/status":
+		backupStatus.writeJSON(w)
+		return true
+	default:
+		return false
+	}
+}
+
+func usage() {
+	const s = `
+vmbackup creates VictoriaMetrics backups from instant snapshots.
+
+See the docs at https://github.com/VictoriaMetrics/VictoriaMetrics/blob/master/app/vmbackup/README.md .
+`
+
+	f := flag.CommandLine.Output()
+	fmt.Fprintf(f, "%s\n", s)
+	flag.PrintDefaults()
+}
+
+func newSrcFS() (*fslocal.FS, error) {
+	if len(*storageDataPath) == 0 {
+		return nil, fmt.Errorf("`-storageDataPath` cannot be empty")
+	}
+	fs := &fslocal.FS{
+		Dir: *storageDataPath,
+	}
+	return fs, nil
+}
+
+func newDstFS() (common.RemoteFS, error) {
+	fs, err := actions.NewRemoteFS(*dst)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `-dst`=%q: %s", *dst, err)
+	}
+	return fs, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// status tracks the running state of the backup for the /metrics and
+// /-/status endpoints.
+type status struct {
+	bytesUploaded uint64
+	backupSize    uint64
+
+	mu        sync.Mutex
+	running   bool
+	finished  bool
+	startTime time.Time
+	stats     actions.ProgressStats
+}
+
+func (s *status) setRunning(backupSize uint64) {
+	atomic.StoreUint64(&s.backupSize, backupSize)
+	s.mu.Lock()
+	s.running = true
+	s.startTime = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *status) addBytes(n uint64) {
+	atomic.AddUint64(&s.bytesUploaded, n)
+}
+
+func (s *status) setFinished(stats actions.ProgressStats) {
+	s.mu.Lock()
+	s.running = false
+	s.finished = true
+	s.stats = stats
+	s.mu.Unlock()
+}
+
+// etaSeconds estimates the number of seconds left until the backup finishes,
+// extrapolating from the upload rate observed so far. It returns 0 once the
+// backup isn't running or hasn't uploaded anything yet.
+func (s *status) etaSeconds() float64 {
+	s.mu.Lock()
+	running := s.running
+	startTime := s.startTime
+	s.mu.Unlock()
+	if !running {
+		return 0
+	}
+	uploaded := atomic.LoadUint64(&s.bytesUploaded)
+	backupSize := atomic.LoadUint64(&s.backupSize)
+	if uploaded == 0 || backupSize <= uploaded {
+		return 0
+	}
+	elapsed := time.Since(startTime).Seconds()
+	rate := float64(uploaded) / elapsed
+	return float64(backupSize-uploaded) / rate
+}
+
+func init() {
+	metrics.GetOrCreateGauge(`vmbackup_backup_size_bytes`, func() float64 {
+		return float64(atomic.LoadUint64(&backupStatus.backupSize))
+	})
+	metrics.GetOrCreateGauge(`vmbackup_bytes_uploaded_total`, func() float64 {
+		return float64(atomic.LoadUint64(&backupStatus.bytesUploaded))
+	})
+	metrics.GetOrCreateGauge(`vmbackup_eta_seconds`, func() float64 {
+		return backupStatus.etaSeconds()
+	})
+}
+
+type statusJSON struct {
+	Running       bool    `json:"running"`
+	Finished      bool    `json:"finished"`
+	BackupSize    uint64  `json:"backup_size"`
+	BytesUploaded uint64  `json:"bytes_uploaded"`
+	ETASeconds    float64 `json:"eta_seconds,omitempty"`
+	DurationMs    int64   `json:"duration_ms,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+func (s *status) writeJSON(w http.ResponseWriter) {
+	s.mu.Lock()
+	sj := statusJSON{
+		Running:       s.running,
+		Finished:      s.finished,
+		BackupSize:    atomic.LoadUint64(&s.backupSize),
+		BytesUploaded: atomic.LoadUint64(&s.bytesUploaded),
+	}
+	if s.finished {
+		sj.DurationMs = s.stats.Duration.Milliseconds()
+		if s.stats.Err != nil {
+			sj.Error = s.stats.Err.Error()
+		}
+	}
+	s.mu.Unlock()
+	if sj.Running {
+		sj.ETASeconds = s.etaSeconds()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sj); err != nil {
+		logger.Errorf("cannot write /-/status response: %s", err)
+	}
+}
@@ -3,12 +3,16 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
 )
 
 var (
@@ -16,14 +20,26 @@ var (
 		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir or fs:///path/to/local/backup/dir")
 	storageDataPath = flag.String("storageDataPath", "victoria-metrics-data", "Destination path where backup must be restored. "+
 		"VictoriaMetrics must be stopped when restoring from backup. -storageDataPath dir can be non-empty. In this case only missing data is downloaded from backup")
-	concurrency = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce restore duration")
+	concurrency           = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce restore duration")
+	httpListenAddr        = flag.String("httpListenAddr", "", "Address to listen for http connections exposing /metrics and /-/status. Leave empty to disable")
+	notifyURL             = flag.String("notifyURL", "", "URL to POST a JSON status payload to once the restore finishes, e.g. for Kubernetes operators or CI to react without tailing logs")
+	minFreeDiskSpaceBytes = flag.Int64("storageDataPath.minFreeDiskSpaceBytes", 0, "The minimum free disk space at -storageDataPath to keep for the duration of the restore. 0 means the library default (1GiB) is used. Only writes made through lib/fs check it; the restore's own file IO doesn't go through lib/fs")
+	ioConcurrency         = flag.Int("storageDataPath.ioConcurrency", 0, "The maximum number of concurrent IO operations allowed against -storageDataPath's underlying device. "+
+		"1 serializes all IO into a single queue, which can roughly double throughput on HDD-backed mounts under concurrent access. 0 (default) applies no limit. "+
+		"Only IO made through lib/fs is limited; the restore's own file IO doesn't go through lib/fs")
 )
 
+var restoreStatus = &status{}
+
 func main() {
 	flag.Usage = usage
 	flag.Parse()
 	buildinfo.Init()
 
+	if len(*httpListenAddr) > 0 {
+		go httpserver.Serve(*httpListenAddr, requestHandler)
+	}
+
 	srcFS, err := newSrcFS()
 	if err != nil {
 		logger.Fatalf("%s", err)
@@ -32,16 +48,43 @@ func main() {
 	if err != nil {
 		logger.Fatalf("%s", err)
 	}
+	fs.RegisterReservation(*storageDataPath, uint64(*minFreeDiskSpaceBytes))
+	fs.SetIOConcurrency(*storageDataPath, *ioConcurrency)
 	a := &actions.Restore{
 		Concurrency: *concurrency,
 		Src:         srcFS,
 		Dst:         dstFS,
+		Progress: &actions.Progress{
+			OnStart: func(backupSize uint64) {
+				restoreStatus.setRunning(backupSize)
+			},
+			OnPartDone: func(p common.Part, bytesTransferred uint64) {
+				restoreStatus.addBytes(bytesTransferred)
+			},
+			OnFinish: func(stats actions.ProgressStats) {
+				restoreStatus.setFinished(stats)
+				actions.Notify(*notifyURL, "restore", stats)
+			},
+		},
 	}
 	if err := a.Run(); err != nil {
 		logger.Fatalf("cannot restore from backup: %s", err)
 	}
 }
 
+func requestHandler(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case "/metrics":
+		metrics.WritePrometheus(w, true)
+		return true
+	case "/-/status":
+		restoreStatus.writeJSON(w)
+		return true
+	default:
+		return false
+	}
+}
+
 func usage() {
 	const s = `
 vmrestore restores VictoriaMetrics data from backups made by vmbackup.
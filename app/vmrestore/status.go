@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// status tracks the running state of the restore for the /metrics and
+// /-/status endpoints.
+type status struct {
+	bytesDownloaded uint64
+	backupSize      uint64
+
+	mu        sync.Mutex
+	running   bool
+	finished  bool
+	startTime time.Time
+	stats     actions.ProgressStats
+}
+
+func (s *status) setRunning(backupSize uint64) {
+	atomic.StoreUint64(&s.backupSize, backupSize)
+	s.mu.Lock()
+	s.running = true
+	s.startTime = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *status) addBytes(n uint64) {
+	atomic.AddUint64(&s.bytesDownloaded, n)
+}
+
+func (s *status) setFinished(stats actions.ProgressStats) {
+	s.mu.Lock()
+	s.running = false
+	s.finished = true
+	s.stats = stats
+	s.mu.Unlock()
+}
+
+// etaSeconds estimates the number of seconds left until the restore
+// finishes, extrapolating from the download rate observed so far. It
+// returns 0 once the restore isn't running or hasn't downloaded anything yet.
+func (s *status) etaSeconds() float64 {
+	s.mu.Lock()
+	running := s.running
+	startTime := s.startTime
+	s.mu.Unlock()
+	if !running {
+		return 0
+	}
+	downloaded := atomic.LoadUint64(&s.bytesDownloaded)
+	backupSize := atomic.LoadUint64(&s.backupSize)
+	if downloaded == 0 || backupSize <= downloaded {
+		return 0
+	}
+	elapsed := time.Since(startTime).Seconds()
+	rate := float64(downloaded) / elapsed
+	return float64(backupSize-downloaded) / rate
+}
+
+func init() {
+	metrics.GetOrCreateGauge(`vmrestore_backup_size_bytes`, func() float64 {
+		return float64(atomic.LoadUint64(&restoreStatus.backupSize))
+	})
+	metrics.GetOrCreateGauge(`vmrestore_bytes_downloaded_total`, func() float64 {
+		return float64(atomic.LoadUint64(&restoreStatus.bytesDownloaded))
+	})
+	metrics.GetOrCreateGauge(`vmrestore_eta_seconds`, func() float64 {
+		return restoreStatus.etaSeconds()
+	})
+}
+
+type statusJSON struct {
+	Running         bool    `json:"running"`
+	Finished        bool    `json:"finished"`
+	BackupSize      uint64  `json:"backup_size"`
+	BytesDownloaded uint64  `json:"bytes_downloaded"`
+	ETASeconds      float64 `json:"eta_seconds,omitempty"`
+	DurationMs      int64   `json:"duration_ms,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+func (s *status) writeJSON(w http.ResponseWriter) {
+	s.mu.Lock()
+	sj := statusJSON{
+		Running:         s.running,
+		Finished:        s.finished,
+		BackupSize:      atomic.LoadUint64(&s.backupSize),
+		BytesDownloaded: atomic.LoadUint64(&s.bytesDownloaded),
+	}
+	if s.finished {
+		sj.DurationMs = s.stats.Duration.Milliseconds()
+		if s.stats.Err != nil {
+			sj.Error = s.stats.Err.Error()
+		}
+	}
+	s.mu.Unlock()
+	if sj.Running {
+		sj.ETASeconds = s.etaSeconds()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sj); err != nil {
+		logger.Errorf("cannot write /-/status response: %s", err)
+	}
+}
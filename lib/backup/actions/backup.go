@@ -0,0 +1,191 @@
+package actions
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// Backup uploads data according to the provided settings.
+type Backup struct {
+	// Concurrency is the number of concurrent workers to run during backup.
+	// Concurrency=1 is used by default.
+	Concurrency int
+
+	// Src is the local data directory to back up.
+	Src *fslocal.FS
+
+	// Dst is the destination to upload the backup to.
+	//
+	// If dst already contains parts from a previous backup, then only new
+	// data is uploaded.
+	Dst common.RemoteFS
+
+	// Progress, when set, is notified as the backup makes progress.
+	Progress *Progress
+}
+
+// Run runs b with the provided settings.
+func (b *Backup) Run() (err error) {
+	startTime := time.Now()
+
+	concurrency := b.Concurrency
+	src := b.Src
+	dst := b.Dst
+	logger.Infof("starting backup from %s to %s", src, dst)
+
+	bytesUploaded := uint64(0)
+	defer func() {
+		b.Progress.onFinish(ProgressStats{
+			BytesTransferred: atomic.LoadUint64(&bytesUploaded),
+			Duration:         time.Since(startTime),
+			Err:              err,
+		})
+	}()
+
+	logger.Infof("obtaining list of parts at %s", src)
+	srcParts, err := src.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list src parts: %s", err)
+	}
+	logger.Infof("obtaining list of parts at %s", dst)
+	dstParts, err := dst.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list dst parts: %s", err)
+	}
+
+	backupSize := getPartsSize(srcParts)
+	b.Progress.onStart(backupSize)
+
+	partsToDelete := common.PartsDifference(dstParts, srcParts)
+	deleteSize := uint64(0)
+	if len(partsToDelete) > 0 {
+		logger.Infof("deleting %d parts from %s", len(partsToDelete), dst)
+		for _, p := range partsToDelete {
+			logger.Infof("deleting %s from %s", &p, dst)
+			if err := dst.DeletePart(p); err != nil {
+				return fmt.Errorf("cannot delete %s from %s: %s", &p, dst, err)
+			}
+			deleteSize += p.ActualSize
+		}
+		if err := dst.RemoveEmptyDirs(); err != nil {
+			return fmt.Errorf("cannot remove empty directories at %s: %s", dst, err)
+		}
+	}
+
+	// Re-read dstParts, since some parts may have been removed on the previous step.
+	dstParts, err = dst.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list dst parts after the deletion: %s", err)
+	}
+
+	partsToUpload := common.PartsDifference(srcParts, dstParts)
+	uploadSize := getPartsSize(partsToUpload)
+	if len(partsToUpload) > 0 {
+		perPath := make(map[string][]common.Part)
+		for _, p := range partsToUpload {
+			perPath[p.Path] = append(perPath[p.Path], p)
+		}
+		logger.Infof("uploading %d parts from %s to %s", len(partsToUpload), src, dst)
+		err = runParallelPerPath(concurrency, perPath, func(parts []common.Part) error {
+			for _, p := range parts {
+				logger.Infof("uploading %s from %s to %s", &p, src, dst)
+				if err := b.uploadPart(p, &bytesUploaded); err != nil {
+					return fmt.Errorf("cannot upload %s to %s: %s", &p, dst, err)
+				}
+				b.Progress.onPartDone(p, p.Size)
+			}
+			return nil
+		}, func(elapsed time.Duration) {
+			n := atomic.LoadUint64(&bytesUploaded)
+			logger.Infof("uploaded %d out of %d bytes from %s to %s in %s", n, uploadSize, src, dst, elapsed)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Infof("backed up %d bytes in %s; deleted %d bytes; uploaded %d bytes", backupSize, time.Since(startTime), deleteSize, uploadSize)
+
+	return nil
+}
+
+// uploadPart uploads p from b.Src to b.Dst, resuming a previously interrupted
+// upload via the .upload-state sidecar left next to p's local file, if any.
+func (b *Backup) uploadPart(p common.Part, bytesUploaded *uint64) error {
+	statePath := uploadStatePath(b.Src.Dir, p)
+
+	us, err := loadUploadState(statePath)
+	if err != nil {
+		logger.Errorf("cannot load upload state for %s, restarting the upload from scratch: %s", &p, err)
+		us = nil
+	}
+	resume := us != nil && us.Part == p
+
+	fw, err := b.Dst.Writer(p, resume)
+	if err != nil && resume {
+		// The backend may not support resuming an upload (e.g. gcsremote).
+		// Fall back to restarting the part from scratch rather than failing
+		// the whole backup over a stale sidecar.
+		logger.Warnf("cannot resume upload of %s: %s; restarting it from scratch", &p, err)
+		resume = false
+		fw, err = b.Dst.Writer(p, false)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot create writer for %s: %s", &p, err)
+	}
+
+	rc, err := b.Src.NewReadCloser(p)
+	if err != nil {
+		return fmt.Errorf("cannot open reader for %s: %s", &p, err)
+	}
+	defer rc.Close()
+
+	if resume && fw.Size() > 0 {
+		if _, err := io.CopyN(io.Discard, rc, fw.Size()); err != nil {
+			return fmt.Errorf("cannot skip %d already-uploaded bytes for %s: %s", fw.Size(), &p, err)
+		}
+	}
+
+	buf := make([]byte, 1024*1024)
+	for {
+		n, readErr := rc.Read(buf)
+		if n > 0 {
+			if _, err := fw.Write(buf[:n]); err != nil {
+				_ = fw.Cancel()
+				return fmt.Errorf("cannot write %d bytes: %s", n, err)
+			}
+			atomic.AddUint64(bytesUploaded, uint64(n))
+			if err := saveUploadState(statePath, &uploadState{Part: p, BytesWritten: fw.Size()}); err != nil {
+				logger.Errorf("cannot save upload state for %s: %s", &p, err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			_ = fw.Cancel()
+			return fmt.Errorf("cannot read data: %s", readErr)
+		}
+	}
+
+	if err := fw.Commit(); err != nil {
+		return fmt.Errorf("cannot finalize upload: %s", err)
+	}
+	if err := deleteUploadState(statePath); err != nil {
+		logger.Errorf("cannot delete upload state for %s: %s", &p, err)
+	}
+	return nil
+}
+
+// uploadStatePath returns the local path the .upload-state sidecar for p is
+// stored at, derived from p's remote naming so it stays unique per part.
+func uploadStatePath(srcDir string, p common.Part) string {
+	return filepath.Join(srcDir, p.RemotePath(""))
+}
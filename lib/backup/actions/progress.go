@@ -0,0 +1,117 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// Progress is a set of callbacks that Backup and Restore invoke as they make
+// progress, in addition to their regular logger.Infof reporting.
+//
+// Every field is optional; nil callbacks are simply skipped.
+type Progress struct {
+	// OnStart is called once, after the source and destination parts have
+	// been listed, with the total size in bytes of the source parts. For an
+	// incremental operation this includes parts that already exist at the
+	// destination and aren't transferred.
+	OnStart func(totalSize uint64)
+
+	// OnPartDone is called after every part has been fully transferred.
+	OnPartDone func(p common.Part, bytesTransferred uint64)
+
+	// OnFinish is called once the transfer completes, successfully or not.
+	OnFinish func(stats ProgressStats)
+}
+
+// ProgressStats is passed to Progress.OnFinish.
+type ProgressStats struct {
+	// BytesTransferred is the total number of bytes transferred.
+	BytesTransferred uint64
+
+	// Duration is how long the operation took.
+	Duration time.Duration
+
+	// Err is the error the operation finished with, or nil on success.
+	Err error
+}
+
+func (pr *Progress) onStart(totalSize uint64) {
+	if pr != nil && pr.OnStart != nil {
+		pr.OnStart(totalSize)
+	}
+}
+
+func (pr *Progress) onPartDone(p common.Part, bytesTransferred uint64) {
+	if pr != nil && pr.OnPartDone != nil {
+		pr.OnPartDone(p, bytesTransferred)
+	}
+}
+
+func (pr *Progress) onFinish(stats ProgressStats) {
+	if pr != nil && pr.OnFinish != nil {
+		pr.OnFinish(stats)
+	}
+}
+
+// notifyClient is used for -notifyURL requests, so a hanging endpoint can't
+// block a Backup/Restore from ever returning.
+var notifyClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// notifyPayload is the JSON body POSTed to -notifyURL on completion.
+type notifyPayload struct {
+	Phase      string `json:"phase"`
+	Status     string `json:"status"`
+	Bytes      uint64 `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Notify POSTs a small JSON status payload describing stats to notifyURL.
+//
+// Failures to notify are logged, but don't fail the calling Backup/Restore,
+// since the data transfer itself already succeeded or failed independently.
+func Notify(notifyURL, phase string, stats ProgressStats) {
+	if len(notifyURL) == 0 {
+		return
+	}
+	status := "ok"
+	errMsg := ""
+	if stats.Err != nil {
+		status = "failed"
+		errMsg = stats.Err.Error()
+	}
+	payload := notifyPayload{
+		Phase:      phase,
+		Status:     status,
+		Bytes:      stats.BytesTransferred,
+		DurationMs: stats.Duration.Milliseconds(),
+		Error:      errMsg,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logger.Errorf("BUG: cannot marshal notify payload: %s", err)
+		return
+	}
+	resp, err := notifyClient.Post(notifyURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		logger.Errorf("cannot send notification to -notifyURL=%q: %s", notifyURL, err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		logger.Errorf("unexpected status code returned from -notifyURL=%q: %d; want 2xx", notifyURL, resp.StatusCode)
+	}
+}
+
+// String returns human-readable representation of stats.
+func (stats ProgressStats) String() string {
+	return fmt.Sprintf("bytes=%d, duration=%s, err=%v", stats.BytesTransferred, stats.Duration, stats.Err)
+}
@@ -0,0 +1,257 @@
+package actions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// Prune enforces a GFS (keep-last/daily/weekly/monthly) retention policy
+// plus an optional total-size cap over the snapshots stored at Storage.
+type Prune struct {
+	// Concurrency is the number of concurrent workers used for deleting parts.
+	// Concurrency=1 is used by default.
+	Concurrency int
+
+	// Storage is the remote storage holding the backups to prune.
+	Storage common.RemoteFS
+
+	// KeepLast is the number of most recent snapshots to keep regardless
+	// of their age.
+	KeepLast int
+
+	// KeepDaily is the number of days for which one daily snapshot is kept.
+	KeepDaily int
+
+	// KeepWeekly is the number of weeks for which one weekly snapshot is kept.
+	KeepWeekly int
+
+	// KeepMonthly is the number of months for which one monthly snapshot is kept.
+	KeepMonthly int
+
+	// MaxTotalSize, when non-zero, caps the total size of the surviving
+	// backups. The oldest surviving snapshots are dropped first until the
+	// cap is satisfied.
+	MaxTotalSize uint64
+
+	// MinPartsThreshold is a safety guard: Prune refuses to do anything if
+	// ListParts returns fewer parts than this, since that usually means the
+	// listing failed transiently rather than the backup directory being
+	// genuinely small.
+	MinPartsThreshold int
+
+	// DryRun, when set, makes Prune only log the snapshots and orphan parts
+	// it would delete, without actually deleting anything.
+	DryRun bool
+}
+
+// snapshot groups the parts belonging to a single backup, keyed by the
+// top-level directory component of common.Part.Path (the snapshot/backup ID).
+type snapshot struct {
+	id    string
+	parts []common.Part
+	size  uint64
+	// time is parsed from id, which is expected to look like a
+	// vmbackupmanager-style timestamp, e.g. "2023-01-02T15:04:05".
+	time time.Time
+}
+
+// Run runs p with the configured settings.
+func (p *Prune) Run() error {
+	concurrency := p.Concurrency
+	storage := p.Storage
+
+	logger.Infof("obtaining list of parts at %s for pruning", storage)
+	parts, err := storage.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list parts at %s: %s", storage, err)
+	}
+	if p.MinPartsThreshold > 0 && len(parts) < p.MinPartsThreshold {
+		return fmt.Errorf("refusing to prune %s: got only %d parts, which is less than -retention.minPartsThreshold=%d; "+
+			"this usually means the listing failed transiently", storage, len(parts), p.MinPartsThreshold)
+	}
+
+	snapshots := groupSnapshots(parts)
+	toKeep, toDrop := p.selectSnapshotsToDrop(snapshots)
+
+	var partsToDelete []common.Part
+	for _, sn := range toDrop {
+		logger.Infof("pruning snapshot %q from %s (%d bytes)", sn.id, storage, sn.size)
+		partsToDelete = append(partsToDelete, sn.parts...)
+	}
+
+	orphans := findOrphanParts(toKeep)
+	for _, orphan := range orphans {
+		logger.Infof("pruning orphan part %s from %s, superseded by a newer version of %q", &orphan, storage, orphan.Path)
+	}
+	partsToDelete = append(partsToDelete, orphans...)
+
+	if len(partsToDelete) == 0 {
+		logger.Infof("nothing to prune at %s", storage)
+		return nil
+	}
+
+	if p.DryRun {
+		logger.Infof("dry run: would delete %d parts from %s", len(partsToDelete), storage)
+		return nil
+	}
+
+	perPath := make(map[string][]common.Part)
+	for _, part := range partsToDelete {
+		perPath[part.Path] = append(perPath[part.Path], part)
+	}
+	logger.Infof("deleting %d parts from %s", len(partsToDelete), storage)
+	return runParallelPerPath(concurrency, perPath, func(parts []common.Part) error {
+		for _, part := range parts {
+			if err := storage.DeletePart(part); err != nil {
+				return fmt.Errorf("cannot delete %s from %s: %s", &part, storage, err)
+			}
+		}
+		return nil
+	}, func(elapsed time.Duration) {
+		logger.Infof("pruning %s: %s elapsed", storage, elapsed)
+	})
+}
+
+// selectSnapshotsToDrop applies the GFS + size-cap rules to snapshots and
+// returns the snapshots to keep and the snapshots to drop, both sorted from
+// newest to oldest.
+func (p *Prune) selectSnapshotsToDrop(snapshots []snapshot) (toKeep, toDrop []snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].time.After(snapshots[j].time)
+	})
+
+	keep := make(map[string]bool)
+	for i, sn := range snapshots {
+		if p.KeepLast > 0 && i < p.KeepLast {
+			keep[sn.id] = true
+		}
+	}
+	markBucketed(snapshots, keep, p.KeepDaily, func(t time.Time) string {
+		y, m, d := t.Date()
+		return fmt.Sprintf("d%04d%02d%02d", y, m, d)
+	})
+	markBucketed(snapshots, keep, p.KeepWeekly, func(t time.Time) string {
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("w%04d%02d", y, w)
+	})
+	markBucketed(snapshots, keep, p.KeepMonthly, func(t time.Time) string {
+		y, m, _ := t.Date()
+		return fmt.Sprintf("m%04d%02d", y, m)
+	})
+
+	var totalSize uint64
+	capReached := false
+	for _, sn := range snapshots {
+		if !keep[sn.id] {
+			toDrop = append(toDrop, sn)
+			continue
+		}
+		if p.MaxTotalSize > 0 && (capReached || totalSize+sn.size > p.MaxTotalSize) {
+			capReached = true
+			toDrop = append(toDrop, sn)
+			continue
+		}
+		totalSize += sn.size
+		toKeep = append(toKeep, sn)
+	}
+	return toKeep, toDrop
+}
+
+// findOrphanParts performs a mark-and-sweep pass over the parts of the
+// surviving snapshots, returning parts that are no longer referenced by the
+// current version of the file they belong to.
+//
+// A file's parts must all agree on FileSize, since together they're supposed
+// to exactly tile a file of that size (see the validation Restore performs on
+// srcParts). When a path has parts with more than one distinct FileSize,
+// the smaller FileSize(s) are leftovers from an earlier, since-superseded
+// version of that file (e.g. left behind by an interrupted incremental
+// backup) - they can never be referenced again and are safe to delete, even
+// though the snapshot itself survives pruning.
+func findOrphanParts(snapshots []snapshot) []common.Part {
+	var orphans []common.Part
+	for _, sn := range snapshots {
+		maxFileSize := make(map[string]uint64)
+		for _, part := range sn.parts {
+			if part.FileSize > maxFileSize[part.Path] {
+				maxFileSize[part.Path] = part.FileSize
+			}
+		}
+		for _, part := range sn.parts {
+			if part.FileSize < maxFileSize[part.Path] {
+				orphans = append(orphans, part)
+			}
+		}
+	}
+	return orphans
+}
+
+// markBucketed keeps at most one (the newest) snapshot per bucket produced by
+// bucketFn, for up to maxBuckets distinct buckets.
+func markBucketed(snapshots []snapshot, keep map[string]bool, maxBuckets int, bucketFn func(time.Time) string) {
+	if maxBuckets <= 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, sn := range snapshots {
+		if len(seen) >= maxBuckets {
+			return
+		}
+		b := bucketFn(sn.time)
+		if seen[b] {
+			continue
+		}
+		seen[b] = true
+		keep[sn.id] = true
+	}
+}
+
+// groupSnapshots groups parts by their snapshot/backup ID.
+func groupSnapshots(parts []common.Part) []snapshot {
+	byID := make(map[string]*snapshot)
+	for _, part := range parts {
+		id := snapshotID(part.Path)
+		sn, ok := byID[id]
+		if !ok {
+			sn = &snapshot{
+				id:   id,
+				time: parseSnapshotTime(id),
+			}
+			byID[id] = sn
+		}
+		sn.parts = append(sn.parts, part)
+		sn.size += part.Size
+	}
+	snapshots := make([]snapshot, 0, len(byID))
+	for _, sn := range byID {
+		snapshots = append(snapshots, *sn)
+	}
+	return snapshots
+}
+
+// snapshotID returns the top-level directory component of path, which
+// encodes the snapshot/backup ID produced by vmbackup.
+func snapshotID(path string) string {
+	idx := strings.IndexByte(path, '/')
+	if idx < 0 {
+		return path
+	}
+	return path[:idx]
+}
+
+// parseSnapshotTime tries to parse the whole id as a vmbackupmanager-style
+// timestamp, falling back to the zero time if it doesn't look like one.
+func parseSnapshotTime(id string) time.Time {
+	layouts := []string{"2006-01-02T15:04:05Z0700", time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, id); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
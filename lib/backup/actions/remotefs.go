@@ -0,0 +1,51 @@
+package actions
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	// Register the built-in drivers. Each of them calls common.RegisterDriver
+	// from its own init(), so importing them for their side effects is enough.
+	_ "github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/azblob"
+	_ "github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/gcsremote"
+	_ "github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/s3remote"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+)
+
+// NewRemoteFS returns RemoteFS built from the given path.
+//
+// Supported path schemes are fs:// plus whatever has been registered via
+// common.RegisterDriver - the built-in gcs://, s3:// and azblob:// drivers,
+// and any third-party driver imported for its side effects elsewhere in the
+// binary.
+func NewRemoteFS(path string) (common.RemoteFS, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("`path` cannot be empty")
+	}
+	if strings.HasPrefix(path, "fs://") {
+		dir := path[len("fs://"):]
+		if len(dir) == 0 {
+			return nil, fmt.Errorf("`dir` cannot be empty")
+		}
+		fs := &fslocal.FS{
+			Dir: dir,
+		}
+		return fs, nil
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse path=%q: %s", path, err)
+	}
+	factory, ok := common.GetDriver(u.Scheme)
+	if !ok {
+		return nil, fmt.Errorf("unsupported scheme %q for path %q; see common.RegisterDriver for how to add support for it", u.Scheme, path)
+	}
+	fs, err := factory(u)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize connection to %q: %s", path, err)
+	}
+	return fs, nil
+}
@@ -28,10 +28,13 @@ type Restore struct {
 	// If dst points to existing directory, then incremental restore is performed,
 	// i.e. only new data is downloaded from src.
 	Dst *fslocal.FS
+
+	// Progress, when set, is notified as the restore makes progress.
+	Progress *Progress
 }
 
 // Run runs r with the provided settings.
-func (r *Restore) Run() error {
+func (r *Restore) Run() (err error) {
 	startTime := time.Now()
 
 	concurrency := r.Concurrency
@@ -39,6 +42,15 @@ func (r *Restore) Run() error {
 	dst := r.Dst
 	logger.Infof("starting restore from %s to %s", src, dst)
 
+	bytesDownloaded := uint64(0)
+	defer func() {
+		r.Progress.onFinish(ProgressStats{
+			BytesTransferred: atomic.LoadUint64(&bytesDownloaded),
+			Duration:         time.Since(startTime),
+			Err:              err,
+		})
+	}()
+
 	logger.Infof("obtaining list of parts at %s", src)
 	srcParts, err := src.ListParts()
 	if err != nil {
@@ -51,6 +63,7 @@ func (r *Restore) Run() error {
 	}
 
 	backupSize := getPartsSize(srcParts)
+	r.Progress.onStart(backupSize)
 
 	// Validate srcParts. They must cover the whole files.
 	common.SortParts(srcParts)
@@ -122,7 +135,6 @@ func (r *Restore) Run() error {
 			perPath[p.Path] = parts
 		}
 		logger.Infof("downloading %d parts from %s to %s", len(partsToCopy), src, dst)
-		bytesDownloaded := uint64(0)
 		err = runParallelPerPath(concurrency, perPath, func(parts []common.Part) error {
 			// Sort partsToCopy in order to properly grow file size during downloading.
 			common.SortParts(parts)
@@ -142,6 +154,7 @@ func (r *Restore) Run() error {
 				if err := wc.Close(); err != nil {
 					return fmt.Errorf("cannot close reader fro %s from %s: %s", &p, src, err)
 				}
+				r.Progress.onPartDone(p, p.Size)
 			}
 			return nil
 		}, func(elapsed time.Duration) {
@@ -0,0 +1,66 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+// uploadStateSuffix is appended to the local directory entry tracking
+// an in-flight part upload, so a restarted vmbackup can re-attach to it
+// instead of restarting the part from byte zero.
+const uploadStateSuffix = ".upload-state"
+
+// uploadState is persisted next to an in-flight upload so Backup can resume
+// it via RemoteFS.Writer(p, true) after a restart.
+type uploadState struct {
+	// Part is the part being uploaded.
+	Part common.Part
+
+	// BytesWritten is the number of bytes already written to the part's
+	// FileWriter at the time the sidecar was last saved.
+	BytesWritten int64
+}
+
+// loadUploadState reads the upload state previously saved for path, if any.
+//
+// It returns nil, nil if no sidecar exists for path.
+func loadUploadState(path string) (*uploadState, error) {
+	data, err := os.ReadFile(path + uploadStateSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read upload state for %q: %s", path, err)
+	}
+	var us uploadState
+	if err := json.Unmarshal(data, &us); err != nil {
+		return nil, fmt.Errorf("cannot parse upload state for %q: %s", path, err)
+	}
+	return &us, nil
+}
+
+// saveUploadState persists us next to path, so a restarted Backup can resume
+// the upload from BytesWritten instead of starting over.
+func saveUploadState(path string, us *uploadState) error {
+	data, err := json.Marshal(us)
+	if err != nil {
+		return fmt.Errorf("cannot marshal upload state for %q: %s", path, err)
+	}
+	if err := os.WriteFile(path+uploadStateSuffix, data, 0644); err != nil {
+		return fmt.Errorf("cannot write upload state for %q: %s", path, err)
+	}
+	return nil
+}
+
+// deleteUploadState removes the sidecar left by saveUploadState once the
+// upload it describes has been committed.
+func deleteUploadState(path string) error {
+	err := os.Remove(path + uploadStateSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete upload state for %q: %s", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package actions
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+// getPartsSize returns the total size of the given parts.
+func getPartsSize(parts []common.Part) uint64 {
+	n := uint64(0)
+	for _, p := range parts {
+		n += p.Size
+	}
+	return n
+}
+
+// runParallelPerPath runs f for every group of parts in perPath, using up to
+// concurrency workers. All the parts for a single path are processed by f
+// sequentially within a single call, but parts from different paths may be
+// processed concurrently.
+//
+// progress is periodically invoked with the time elapsed since the call
+// started, so the caller can log throughput while the processing is running.
+func runParallelPerPath(concurrency int, perPath map[string][]common.Part, f func(parts []common.Part) error, progress func(elapsed time.Duration)) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	startTime := time.Now()
+	stopCh := make(chan struct{})
+	var progressWG sync.WaitGroup
+	if progress != nil {
+		progressWG.Add(1)
+		go func() {
+			defer progressWG.Done()
+			t := time.NewTicker(5 * time.Second)
+			defer t.Stop()
+			for {
+				select {
+				case <-stopCh:
+					return
+				case <-t.C:
+					progress(time.Since(startTime))
+				}
+			}
+		}()
+	}
+
+	workCh := make(chan []common.Part, len(perPath))
+	for _, parts := range perPath {
+		workCh <- parts
+	}
+	close(workCh)
+
+	resultCh := make(chan error, len(perPath))
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for parts := range workCh {
+				resultCh <- f(parts)
+			}
+		}()
+	}
+	wg.Wait()
+	close(resultCh)
+	close(stopCh)
+	progressWG.Wait()
+
+	var firstErr error
+	for err := range resultCh {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,316 @@
+package azblob
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+func init() {
+	common.RegisterDriver("azblob", newFS)
+}
+
+func newFS(u *url.URL) (common.RemoteFS, error) {
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("missing container in azblob path %q", u)
+	}
+	q := u.Query()
+	fs := &FS{
+		AccountName: q.Get("account"),
+		AccountKey:  q.Get("accountKey"),
+		SASToken:    q.Get("sasToken"),
+		Container:   u.Host,
+		Dir:         strings.TrimPrefix(u.Path, "/"),
+	}
+	if err := fs.Init(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// FS represents filesystem for backups in Azure Blob Storage.
+//
+// Init must be called before calling other FS methods.
+type FS struct {
+	// AccountName is an Azure Storage account name.
+	AccountName string
+
+	// AccountKey is an Azure Storage account access key.
+	//
+	// It is used for authentication if set. Otherwise SASToken is used,
+	// and if that is empty too, Managed Identity credentials are used.
+	AccountKey string
+
+	// SASToken is a shared access signature token to use for authentication
+	// when AccountKey is empty.
+	SASToken string
+
+	// Container is an Azure Blob container to use.
+	Container string
+
+	// Dir is a directory in the container to write to.
+	Dir string
+
+	containerURL azblob.ContainerURL
+	initialized  bool
+}
+
+// Init initializes fs.
+func (fs *FS) Init() error {
+	if fs.initialized {
+		logger.Panicf("BUG: fs.Init has been already called")
+	}
+	for strings.HasPrefix(fs.Dir, "/") {
+		fs.Dir = fs.Dir[1:]
+	}
+	if !strings.HasSuffix(fs.Dir, "/") {
+		fs.Dir += "/"
+	}
+	cred, err := fs.newCredential()
+	if err != nil {
+		return fmt.Errorf("cannot create credential for Azure Blob Storage account %q: %s", fs.AccountName, err)
+	}
+	p := azblob.NewPipeline(cred, azblob.PipelineOptions{})
+	rawURL := fmt.Sprintf("https://%s.blob.core.windows.net/%s", fs.AccountName, fs.Container)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("cannot parse container URL %q: %s", rawURL, err)
+	}
+	if len(fs.AccountKey) == 0 && len(fs.SASToken) > 0 {
+		// The pipeline's anonymous credential doesn't know about SASToken, so
+		// the token must be carried on the URL itself for every request.
+		u.RawQuery = strings.TrimPrefix(fs.SASToken, "?")
+	}
+	fs.containerURL = azblob.NewContainerURL(*u, p)
+	fs.initialized = true
+	return nil
+}
+
+// newCredential picks the strongest available authentication method:
+// account key, then SAS token, then Managed Identity.
+func (fs *FS) newCredential() (azblob.Credential, error) {
+	if len(fs.AccountKey) > 0 {
+		return azblob.NewSharedKeyCredential(fs.AccountName, fs.AccountKey)
+	}
+	if len(fs.SASToken) > 0 {
+		// Auth happens via the SAS token appended to the container URL's
+		// query string in Init, not via the credential itself.
+		return azblob.NewAnonymousCredential(), nil
+	}
+	return azblob.NewMSICredential(azblob.MSICredentialOptions{}), nil
+}
+
+// String returns human-readable description for fs.
+func (fs *FS) String() string {
+	return fmt.Sprintf("azblob{container: %q, dir: %q}", fs.Container, fs.Dir)
+}
+
+// ListParts returns all the parts for fs.
+func (fs *FS) ListParts() ([]common.Part, error) {
+	dir := fs.Dir
+	ctx := context.Background()
+	var parts []common.Part
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := fs.containerURL.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{
+			Prefix: dir,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot list blobs at %q: %s", dir, err)
+		}
+		marker = resp.NextMarker
+		for _, blob := range resp.Segment.BlobItems {
+			file := blob.Name
+			if !strings.HasPrefix(file, dir) {
+				return nil, fmt.Errorf("unexpected prefix for azblob key %q; want %q", file, dir)
+			}
+			var p common.Part
+			if !p.ParseFromRemotePath(file[len(dir):]) {
+				logger.Infof("skipping unknown object %q", file)
+				continue
+			}
+			p.ActualSize = uint64(*blob.Properties.ContentLength)
+			parts = append(parts, p)
+		}
+	}
+	return parts, nil
+}
+
+// DeletePart deletes part p from fs.
+func (fs *FS) DeletePart(p common.Part) error {
+	b := fs.blobURL(p)
+	ctx := context.Background()
+	if _, err := b.Delete(ctx, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{}); err != nil {
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %s", p.Path, fs, b, err)
+	}
+	return nil
+}
+
+// RemoveEmptyDirs recursively removes empty dirs in fs.
+func (fs *FS) RemoveEmptyDirs() error {
+	// Azure Blob Storage has no directories, so nothing to remove.
+	return nil
+}
+
+// copyPollInterval is the delay between GetProperties polls while waiting for
+// a server-side copy to leave the Pending state.
+const copyPollInterval = 2 * time.Second
+
+// copyPollTimeout caps the total time CopyPart waits for a server-side copy
+// to leave the Pending state, so a copy that gets stuck server-side (e.g. a
+// cross-region copy that never progresses) can't hang the whole backup
+// process indefinitely.
+const copyPollTimeout = 15 * time.Minute
+
+// CopyPart copies p from srcFS to fs using the server-side Copy Blob API.
+func (fs *FS) CopyPart(srcFS common.OriginFS, p common.Part) error {
+	src, ok := srcFS.(*FS)
+	if !ok {
+		return fmt.Errorf("cannot perform server-side copying from %s to %s: both of them must be azblob", srcFS, fs)
+	}
+	srcBlob := src.blobURL(p)
+	dstBlob := fs.blobURL(p)
+
+	ctx := context.Background()
+	startCopy, err := dstBlob.StartCopyFromURL(ctx, srcBlob.URL(), azblob.Metadata{}, azblob.ModifiedAccessConditions{}, azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil)
+	if err != nil {
+		return fmt.Errorf("cannot start copying %q from %s to %s: %s", p.Path, src, fs, err)
+	}
+	copyStatus := startCopy.CopyStatus()
+	deadline := time.Now().Add(copyPollTimeout)
+	for copyStatus == azblob.CopyStatusPending {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for copy of %q from %s to %s to leave the %q state", copyPollTimeout, p.Path, src, fs, copyStatus)
+		}
+		time.Sleep(copyPollInterval)
+		props, err := dstBlob.GetProperties(ctx, azblob.BlobAccessConditions{})
+		if err != nil {
+			return fmt.Errorf("cannot poll copy status for %q at %s: %s", p.Path, fs, err)
+		}
+		copyStatus = props.CopyStatus()
+	}
+	if copyStatus != azblob.CopyStatusSuccess {
+		return fmt.Errorf("unexpected copy status for %q from %s to %s: %s", p.Path, src, fs, copyStatus)
+	}
+	return nil
+}
+
+// DownloadPart downloads part p from fs to w.
+func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
+	b := fs.blobURL(p)
+	ctx := context.Background()
+	resp, err := b.Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return fmt.Errorf("cannot open reader for %q at %s (remote path %q): %s", p.Path, fs, b, err)
+	}
+	r := resp.Body(azblob.RetryReaderOptions{})
+	n, err := io.Copy(w, r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from at %s (remote path %q): %s", p.Path, fs, b, err)
+	}
+	if uint64(n) != p.Size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s; got %d bytes; want %d bytes", p.Path, fs, n, p.Size)
+	}
+	return nil
+}
+
+// blockBlobMaxBlockSize is the maximum size of a single staged block.
+//
+// See https://docs.microsoft.com/en-us/rest/api/storageservices/put-block .
+const blockBlobMaxBlockSize = 100 * 1024 * 1024
+
+// Writer returns a common.FileWriter for uploading part p to fs by staging
+// blocks and committing them once Commit is called.
+//
+// If append is true and blocks were already staged for p in a previous,
+// interrupted attempt, they are discovered via GetBlockList and Write resumes
+// staging new blocks after them instead of starting over.
+func (fs *FS) Writer(p common.Part, append bool) (common.FileWriter, error) {
+	b := fs.blobURL(p).ToBlockBlobURL()
+	fw := &fileWriter{
+		fs: fs,
+		p:  p,
+		b:  b,
+	}
+	if append {
+		ctx := context.Background()
+		resp, err := b.GetBlockList(ctx, azblob.BlockListUncommitted, azblob.LeaseAccessConditions{})
+		if err != nil {
+			return nil, fmt.Errorf("cannot list uncommitted blocks for %q at %s (remote path %q): %s", p.Path, fs, b, err)
+		}
+		for _, blk := range resp.UncommittedBlocks {
+			fw.blockIDs = append(fw.blockIDs, blk.Name)
+			fw.n += uint64(blk.Size)
+		}
+	}
+	return fw, nil
+}
+
+type fileWriter struct {
+	fs       *FS
+	p        common.Part
+	b        azblob.BlockBlobURL
+	blockIDs []string
+	n        uint64
+}
+
+// Write stages p as a new block in the underlying block blob.
+//
+// Callers should chunk writes at up to blockBlobMaxBlockSize bytes, since
+// that's the maximum size accepted by the Put Block API for a single block.
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	ctx := context.Background()
+	blockID := blockIDFromIndex(len(fw.blockIDs))
+	if _, err := fw.b.StageBlock(ctx, blockID, bytes.NewReader(p), azblob.LeaseAccessConditions{}, nil); err != nil {
+		return 0, fmt.Errorf("cannot stage block %d for %q at %s (remote path %q): %s", len(fw.blockIDs), fw.p.Path, fw.fs, fw.b, err)
+	}
+	fw.blockIDs = append(fw.blockIDs, blockID)
+	fw.n += uint64(len(p))
+	return len(p), nil
+}
+
+// Size returns the number of bytes staged into fw so far.
+func (fw *fileWriter) Size() int64 {
+	return int64(fw.n)
+}
+
+// Cancel leaves the staged, uncommitted blocks behind; Azure garbage-collects
+// them automatically about a week after they were staged.
+func (fw *fileWriter) Cancel() error {
+	return nil
+}
+
+// Commit commits all staged blocks, making them visible as a single blob.
+func (fw *fileWriter) Commit() error {
+	ctx := context.Background()
+	if _, err := fw.b.CommitBlockList(ctx, fw.blockIDs, azblob.BlobHTTPHeaders{}, azblob.Metadata{}, azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil); err != nil {
+		return fmt.Errorf("cannot commit %d blocks for %q at %s (remote path %q): %s", len(fw.blockIDs), fw.p.Path, fw.fs, fw.b, err)
+	}
+	if fw.n != fw.p.Size {
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", fw.p.Path, fw.fs, fw.n, fw.p.Size)
+	}
+	return nil
+}
+
+func (fs *FS) blobURL(p common.Part) azblob.BlobURL {
+	path := p.RemotePath(fs.Dir)
+	return fs.containerURL.NewBlobURL(path)
+}
+
+// blockIDFromIndex returns a block ID for the block at idx. Block IDs must be
+// valid base64, or Azure rejects StageBlock/CommitBlockList with an "Invalid
+// block ID" error.
+func blockIDFromIndex(idx int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%010d", idx)))
+}
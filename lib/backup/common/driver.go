@@ -0,0 +1,48 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// DriverFactory builds a RemoteFS from a parsed backup/restore path URL.
+//
+// u.Host and u.Path carry the bucket/container and directory, same as for
+// the built-in gcs://, s3:// and azblob:// schemes; query string parameters
+// (e.g. ?partSize=64MB&concurrency=8) are available via u.Query() for
+// provider-specific tuning.
+type DriverFactory func(u *url.URL) (RemoteFS, error)
+
+var (
+	driversMu sync.Mutex
+	drivers   = make(map[string]DriverFactory)
+)
+
+// RegisterDriver registers factory under the given URL scheme, so that
+// actions.NewRemoteFS("scheme://...") constructs a RemoteFS via factory.
+//
+// This lets third-party backends (NFS, SFTP, WebDAV, on-prem object stores)
+// be vendored as separate Go modules that import this package from their
+// own init() function, without patching VictoriaMetrics itself. Built-in
+// drivers (gcs, s3, azblob) register themselves the same way.
+//
+// RegisterDriver panics if scheme is already registered, since that
+// indicates a conflicting import rather than a runtime condition to recover
+// from.
+func RegisterDriver(scheme string, factory DriverFactory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, ok := drivers[scheme]; ok {
+		panic(fmt.Sprintf("BUG: driver for scheme %q is already registered", scheme))
+	}
+	drivers[scheme] = factory
+}
+
+// GetDriver returns the factory registered for scheme, if any.
+func GetDriver(scheme string) (DriverFactory, bool) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	factory, ok := drivers[scheme]
+	return factory, ok
+}
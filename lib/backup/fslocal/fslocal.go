@@ -113,6 +113,85 @@ func (fs *FS) NewWriteCloser(p common.Part) (io.WriteCloser, error) {
 	return wc, nil
 }
 
+// Writer returns a common.FileWriter for uploading part p to fs.
+//
+// If append is true and a file already exists at p's destination path (left
+// behind by a previous, interrupted attempt), Write resumes writing after
+// its current size via filestream.OpenWriterAt instead of starting over.
+func (fs *FS) Writer(p common.Part, append bool) (common.FileWriter, error) {
+	path := fs.path(p)
+	if err := fs.mkdirAll(path); err != nil {
+		return nil, err
+	}
+	var n int64
+	if append {
+		fi, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot stat %q: %s", path, err)
+		}
+		if err == nil {
+			n = fi.Size()
+		}
+	} else if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot remove stale %q before starting a fresh upload: %s", path, err)
+	}
+	w, err := filestream.OpenWriterAt(path, n, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open writer for %q at offset %d: %s", path, n, err)
+	}
+	return &fileWriter{
+		fs:   fs,
+		p:    p,
+		path: path,
+		w:    w,
+		n:    n,
+	}, nil
+}
+
+type fileWriter struct {
+	fs   *FS
+	p    common.Part
+	path string
+	w    *filestream.Writer
+	n    int64
+}
+
+// Write writes p to fw.
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.n += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("cannot write %d bytes to %q: %s", len(p), fw.path, err)
+	}
+	return n, nil
+}
+
+// Size returns the number of bytes written to fw so far.
+func (fw *fileWriter) Size() int64 {
+	return fw.n
+}
+
+// Cancel closes fw and removes the partially-written file.
+func (fw *fileWriter) Cancel() error {
+	fw.w.MustClose()
+	if err := os.Remove(fw.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove canceled upload %q: %s", fw.path, err)
+	}
+	return nil
+}
+
+// Commit closes and fsyncs fw, making the written file visible.
+func (fw *fileWriter) Commit() error {
+	fw.w.MustClose()
+	if err := fscommon.FsyncFile(fw.path); err != nil {
+		return err
+	}
+	if uint64(fw.n) != fw.p.Size {
+		return fmt.Errorf("wrong data size written to %q; got %d bytes; want %d bytes", fw.path, fw.n, fw.p.Size)
+	}
+	return nil
+}
+
 // DeletePath deletes the given path from fs and returns the size
 // for the deleted file.
 func (fs *FS) DeletePath(path string) (uint64, error) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
 
 	"cloud.google.com/go/storage"
@@ -13,6 +14,25 @@ import (
 	"google.golang.org/api/option"
 )
 
+func init() {
+	common.RegisterDriver("gcs", newFS)
+}
+
+func newFS(u *url.URL) (common.RemoteFS, error) {
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("missing bucket in gcs path %q", u)
+	}
+	fs := &FS{
+		CredsFilePath: u.Query().Get("credsFilePath"),
+		Bucket:        u.Host,
+		Dir:           strings.TrimPrefix(u.Path, "/"),
+	}
+	if err := fs.Init(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
 // FS represents filesystem for backups in GCS.
 //
 // Init must be called before calling other FS methods.
@@ -156,20 +176,63 @@ func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
 	return nil
 }
 
-// UploadPart uploads part p from r to fs.
-func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
+// Writer returns a common.FileWriter for uploading part p to fs.
+//
+// Unlike the block-based backends, GCS has no way to resume an upload into
+// an existing object from an earlier, already-staged byte offset: once the
+// process restarts, the previous resumable session URI is gone and there's
+// no API to recover it. So if append is true, Writer returns an error
+// instead of silently restarting the part from byte zero under the
+// caller's feet; the caller must delete any partial object first and retry
+// with append=false.
+func (fs *FS) Writer(p common.Part, append bool) (common.FileWriter, error) {
+	if append {
+		return nil, fmt.Errorf("cannot resume upload of %q to %s: GCS doesn't support resuming an upload across process restarts", p.Path, fs)
+	}
 	o := fs.object(p)
 	ctx := context.Background()
 	w := o.NewWriter(ctx)
-	n, err := io.Copy(w, r)
-	if err1 := w.Close(); err1 != nil && err == nil {
-		err = err1
-	}
+	return &fileWriter{
+		fs: fs,
+		p:  p,
+		w:  w,
+	}, nil
+}
+
+type fileWriter struct {
+	fs *FS
+	p  common.Part
+	w  *storage.Writer
+	n  int64
+}
+
+// Write writes p to fw, staging it into the underlying resumable session.
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.n += int64(n)
 	if err != nil {
-		return fmt.Errorf("cannot upload data to %q at %s (remote path %q): %s", p.Path, fs, o.ObjectName(), err)
+		return n, fmt.Errorf("cannot upload data to %q at %s: %s", fw.p.Path, fw.fs, err)
 	}
-	if uint64(n) != p.Size {
-		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", p.Path, fs, n, p.Size)
+	return n, nil
+}
+
+// Size returns the number of bytes written to fw so far.
+func (fw *fileWriter) Size() int64 {
+	return fw.n
+}
+
+// Cancel aborts the upload, leaving no object behind.
+func (fw *fileWriter) Cancel() error {
+	return fw.w.CloseWithError(fmt.Errorf("upload of %q to %s has been canceled", fw.p.Path, fw.fs))
+}
+
+// Commit finalizes the upload, making the object visible in the bucket.
+func (fw *fileWriter) Commit() error {
+	if err := fw.w.Close(); err != nil {
+		return fmt.Errorf("cannot finalize upload of %q to %s: %s", fw.p.Path, fw.fs, err)
+	}
+	if uint64(fw.n) != fw.p.Size {
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", fw.p.Path, fw.fs, fw.n, fw.p.Size)
 	}
 	return nil
 }
@@ -0,0 +1,326 @@
+package s3remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func init() {
+	common.RegisterDriver("s3", newFS)
+}
+
+func newFS(u *url.URL) (common.RemoteFS, error) {
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("missing bucket in s3 path %q", u)
+	}
+	q := u.Query()
+	fs := &FS{
+		CustomEndpoint: q.Get("endpoint"),
+		Bucket:         u.Host,
+		Dir:            strings.TrimPrefix(u.Path, "/"),
+	}
+	if err := fs.Init(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// FS represents filesystem for backups in S3 (or an S3-compatible store, via
+// CustomEndpoint).
+//
+// Init must be called before calling other FS methods.
+type FS struct {
+	// CustomEndpoint is an optional S3-compatible endpoint (e.g. for Minio
+	// or another on-prem S3-compatible store). The AWS default is used if
+	// empty.
+	CustomEndpoint string
+
+	// Bucket is an S3 bucket to use.
+	Bucket string
+
+	// Dir is a directory in the bucket to write to.
+	Dir string
+
+	s3 *s3.S3
+}
+
+// Init initializes fs.
+func (fs *FS) Init() error {
+	if fs.s3 != nil {
+		logger.Panicf("BUG: fs.Init has been already called")
+	}
+	for strings.HasPrefix(fs.Dir, "/") {
+		fs.Dir = fs.Dir[1:]
+	}
+	if !strings.HasSuffix(fs.Dir, "/") {
+		fs.Dir += "/"
+	}
+	cfg := aws.NewConfig()
+	if len(fs.CustomEndpoint) > 0 {
+		cfg = cfg.WithEndpoint(fs.CustomEndpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create S3 session: %s", err)
+	}
+	fs.s3 = s3.New(sess)
+	return nil
+}
+
+// String returns human-readable description for fs.
+func (fs *FS) String() string {
+	return fmt.Sprintf("S3{bucket: %q, dir: %q}", fs.Bucket, fs.Dir)
+}
+
+// ListParts returns all the parts for fs.
+func (fs *FS) ListParts() ([]common.Part, error) {
+	dir := fs.Dir
+	var parts []common.Part
+	var innerErr error
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(fs.Bucket),
+		Prefix: aws.String(dir),
+	}
+	err := fs.s3.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			file := aws.StringValue(o.Key)
+			if !strings.HasPrefix(file, dir) {
+				innerErr = fmt.Errorf("unexpected prefix for s3 key %q; want %q", file, dir)
+				return false
+			}
+			var p common.Part
+			if !p.ParseFromRemotePath(file[len(dir):]) {
+				logger.Infof("skipping unknown object %q", file)
+				continue
+			}
+			p.ActualSize = uint64(aws.Int64Value(o.Size))
+			parts = append(parts, p)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list objects at %q: %s", dir, err)
+	}
+	if innerErr != nil {
+		return nil, innerErr
+	}
+	return parts, nil
+}
+
+// DeletePart deletes part p from fs.
+func (fs *FS) DeletePart(p common.Part) error {
+	key := fs.key(p)
+	if _, err := fs.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(fs.Bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %s", p.Path, fs, key, err)
+	}
+	return nil
+}
+
+// RemoveEmptyDirs recursively removes empty dirs in fs.
+func (fs *FS) RemoveEmptyDirs() error {
+	// S3 has no directories, so nothing to remove.
+	return nil
+}
+
+// CopyPart copies p from srcFS to fs using the server-side CopyObject API.
+func (fs *FS) CopyPart(srcFS common.OriginFS, p common.Part) error {
+	src, ok := srcFS.(*FS)
+	if !ok {
+		return fmt.Errorf("cannot perform server-side copying from %s to %s: both of them must be S3", srcFS, fs)
+	}
+	srcKey := src.key(p)
+	dstKey := fs.key(p)
+	source := fmt.Sprintf("%s/%s", src.Bucket, srcKey)
+	if _, err := fs.s3.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(fs.Bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(source),
+	}); err != nil {
+		return fmt.Errorf("cannot copy %q from %s to %s: %s", p.Path, src, fs, err)
+	}
+	return nil
+}
+
+// DownloadPart downloads part p from fs to w.
+func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
+	key := fs.key(p)
+	resp, err := fs.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(fs.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot open reader for %q at %s (remote path %q): %s", p.Path, fs, key, err)
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err1 := resp.Body.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from at %s (remote path %q): %s", p.Path, fs, key, err)
+	}
+	if uint64(n) != p.Size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s; got %d bytes; want %d bytes", p.Path, fs, n, p.Size)
+	}
+	return nil
+}
+
+// Writer returns a common.FileWriter for uploading part p to fs via a
+// multipart upload.
+//
+// If append is true and a multipart upload for p was already started in a
+// previous, interrupted attempt, it is discovered via ListMultipartUploads
+// and its already-uploaded parts are recovered via ListParts, so Write
+// resumes uploading new parts after them instead of starting over.
+func (fs *FS) Writer(p common.Part, append bool) (common.FileWriter, error) {
+	key := fs.key(p)
+	fw := &fileWriter{
+		fs:  fs,
+		p:   p,
+		key: key,
+	}
+	if append {
+		uploadID, err := fs.findUploadID(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot discover in-progress multipart upload for %q at %s (remote path %q): %s", p.Path, fs, key, err)
+		}
+		if len(uploadID) > 0 {
+			fw.uploadID = uploadID
+			if err := fw.loadUploadedParts(); err != nil {
+				return nil, fmt.Errorf("cannot list uploaded parts for %q at %s (remote path %q): %s", p.Path, fs, key, err)
+			}
+		}
+	}
+	if len(fw.uploadID) == 0 {
+		resp, err := fs.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(fs.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot create multipart upload for %q at %s (remote path %q): %s", p.Path, fs, key, err)
+		}
+		fw.uploadID = aws.StringValue(resp.UploadId)
+	}
+	return fw, nil
+}
+
+type fileWriter struct {
+	fs       *FS
+	p        common.Part
+	key      string
+	uploadID string
+	parts    []*s3.CompletedPart
+	n        uint64
+}
+
+// findUploadID returns the upload ID of an in-progress multipart upload for
+// key, if any.
+func (fs *FS) findUploadID(key string) (string, error) {
+	resp, err := fs.s3.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(fs.Bucket),
+		Prefix: aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, u := range resp.Uploads {
+		if aws.StringValue(u.Key) == key {
+			return aws.StringValue(u.UploadId), nil
+		}
+	}
+	return "", nil
+}
+
+// loadUploadedParts populates fw.parts and fw.n from the parts already
+// uploaded under fw.uploadID.
+func (fw *fileWriter) loadUploadedParts() error {
+	resp, err := fw.fs.s3.ListParts(&s3.ListPartsInput{
+		Bucket:   aws.String(fw.fs.Bucket),
+		Key:      aws.String(fw.key),
+		UploadId: aws.String(fw.uploadID),
+	})
+	if err != nil {
+		return err
+	}
+	for _, part := range resp.Parts {
+		fw.parts = append(fw.parts, &s3.CompletedPart{
+			ETag:       part.ETag,
+			PartNumber: part.PartNumber,
+		})
+		fw.n += uint64(aws.Int64Value(part.Size))
+	}
+	return nil
+}
+
+// Write uploads p as a new part of the underlying multipart upload.
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	partNumber := int64(len(fw.parts) + 1)
+	resp, err := fw.fs.s3.UploadPart(&s3.UploadPartInput{
+		Bucket:     aws.String(fw.fs.Bucket),
+		Key:        aws.String(fw.key),
+		UploadId:   aws.String(fw.uploadID),
+		PartNumber: aws.Int64(partNumber),
+		Body:       bytes.NewReader(p),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot upload part %d for %q at %s (remote path %q): %s", partNumber, fw.p.Path, fw.fs, fw.key, err)
+	}
+	fw.parts = append(fw.parts, &s3.CompletedPart{
+		ETag:       resp.ETag,
+		PartNumber: aws.Int64(partNumber),
+	})
+	fw.n += uint64(len(p))
+	return len(p), nil
+}
+
+// Size returns the number of bytes uploaded to fw so far.
+func (fw *fileWriter) Size() int64 {
+	return int64(fw.n)
+}
+
+// Cancel aborts the multipart upload, so S3 doesn't keep billing for the
+// uploaded-but-uncommitted parts.
+func (fw *fileWriter) Cancel() error {
+	_, err := fw.fs.s3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(fw.fs.Bucket),
+		Key:      aws.String(fw.key),
+		UploadId: aws.String(fw.uploadID),
+	})
+	return err
+}
+
+// Commit completes the multipart upload, making the object visible in the bucket.
+func (fw *fileWriter) Commit() error {
+	if _, err := fw.fs.s3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(fw.fs.Bucket),
+		Key:      aws.String(fw.key),
+		UploadId: aws.String(fw.uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: fw.parts,
+		},
+	}); err != nil {
+		return fmt.Errorf("cannot finalize upload of %q to %s: %s", fw.p.Path, fw.fs, err)
+	}
+	if fw.n != fw.p.Size {
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", fw.p.Path, fw.fs, fw.n, fw.p.Size)
+	}
+	return nil
+}
+
+func (fs *FS) key(p common.Part) string {
+	return p.RemotePath(fs.Dir)
+}
@@ -0,0 +1,69 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// DeviceID resolves path to a stable identifier for the underlying block
+// device it lives on, so IO performed on different mountpoints (e.g.
+// -storageDataPath and -cacheDataPath on separate disks) can be attributed
+// separately in per-device metrics.
+//
+// path doesn't need to exist yet, e.g. WriteFileAtomically calls this on the
+// destination path before creating it - DeviceID walks up to the nearest
+// existing ancestor directory in that case, so such paths still resolve to
+// their real device instead of collapsing onto a shared "unknown" bucket.
+func DeviceID(path string) string {
+	return deviceID(existingAncestor(path))
+}
+
+// existingAncestor returns path if it exists, or the nearest existing
+// ancestor directory otherwise.
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// deviceMetrics holds the per-device labelled series mirroring the global
+// vm_fs_read_calls_total / vm_fs_read_bytes_total / vm_fs_readers counters.
+type deviceMetrics struct {
+	readCalls    *metrics.Counter
+	readBytes    *metrics.Counter
+	readersCount *metrics.Counter
+}
+
+var (
+	deviceMetricsMu sync.Mutex
+	deviceMetricsM  = make(map[string]*deviceMetrics)
+)
+
+// metricsForDevice returns the labelled metrics for the given device,
+// creating them on first use.
+func metricsForDevice(device string) *deviceMetrics {
+	deviceMetricsMu.Lock()
+	defer deviceMetricsMu.Unlock()
+	dm, ok := deviceMetricsM[device]
+	if ok {
+		return dm
+	}
+	dm = &deviceMetrics{
+		readCalls:    metrics.GetOrCreateCounter(fmt.Sprintf(`vm_fs_read_calls_total{device=%q}`, device)),
+		readBytes:    metrics.GetOrCreateCounter(fmt.Sprintf(`vm_fs_read_bytes_total{device=%q}`, device)),
+		readersCount: metrics.GetOrCreateCounter(fmt.Sprintf(`vm_fs_readers{device=%q}`, device)),
+	}
+	deviceMetricsM[device] = dm
+	return dm
+}
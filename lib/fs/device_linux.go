@@ -0,0 +1,99 @@
+//go:build linux
+
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// deviceID resolves path to a stable identifier for its underlying block
+// device: the device's UUID (from /dev/disk/by-uuid) if one can be found,
+// plus the mountpoint containing path, so all the paths under one mount
+// share an identifier while IO attributed to different -storageDataPath
+// and -cacheDataPath mounts shows up as distinct labelled series even when
+// the mounts share the same backing disk.
+func deviceID(path string) string {
+	majorMinor, err := majorMinorFor(path)
+	if err != nil {
+		return stDevFallback(path)
+	}
+	uuid := uuidForMajorMinor(majorMinor)
+	mountPoint := mountPointFor(path, majorMinor)
+	if uuid == "" {
+		return fmt.Sprintf("%s:%s", majorMinor, mountPoint)
+	}
+	return fmt.Sprintf("%s:%s", uuid, mountPoint)
+}
+
+func majorMinorFor(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", err
+	}
+	dev := uint64(st.Dev)
+	return fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev)), nil
+}
+
+func stDevFallback(path string) string {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "unknown"
+	}
+	return fmt.Sprintf("dev-%x", uint64(st.Dev))
+}
+
+// uuidForMajorMinor scans /dev/disk/by-uuid for a symlink resolving to the
+// block device with the given "major:minor" identifier. It returns "" if
+// none is found, e.g. when /dev/disk/by-uuid doesn't exist in a container.
+func uuidForMajorMinor(majorMinor string) string {
+	entries, err := os.ReadDir("/dev/disk/by-uuid")
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		linkPath := filepath.Join("/dev/disk/by-uuid", e.Name())
+		var st unix.Stat_t
+		if err := unix.Stat(linkPath, &st); err != nil {
+			continue
+		}
+		dev := uint64(st.Rdev)
+		if fmt.Sprintf("%d:%d", unix.Major(dev), unix.Minor(dev)) == majorMinor {
+			return e.Name()
+		}
+	}
+	return ""
+}
+
+// mountPointFor returns the longest mountpoint, as parsed from
+// /proc/self/mountinfo, that is backed by the device with the given
+// "major:minor" identifier and contains path. It returns "" if none is found.
+func mountPointFor(path, majorMinor string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var mountPoint string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[2] != majorMinor || len(fields[4]) < len(mountPoint) {
+			continue
+		}
+		if fields[4] == "/" || isSubPath(fields[4], absPath) {
+			mountPoint = fields[4]
+		}
+	}
+	return mountPoint
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// deviceID resolves path to a stable identifier for its underlying device.
+//
+// Non-Linux platforms (BSD, Darwin) don't get /proc/self/mountinfo, so this
+// falls back to the raw st_dev value reported by stat(2), which is still
+// stable for the lifetime of a single boot.
+func deviceID(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "unknown"
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("dev-%x", uint64(st.Dev))
+}
@@ -0,0 +1,11 @@
+package fs
+
+import "testing"
+
+func TestDeviceIDNonEmpty(t *testing.T) {
+	dir := t.TempDir()
+	id := DeviceID(dir)
+	if id == "" {
+		t.Fatalf("DeviceID returned an empty string for %q", dir)
+	}
+}
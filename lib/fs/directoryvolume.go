@@ -0,0 +1,147 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"golang.org/x/sys/unix"
+)
+
+// directoryVolume is the default Volume driver. It operates on the local
+// POSIX filesystem directly; the cross-cutting concerns (health checks,
+// reservation, IO serialization, metrics) live in the wrapper functions in
+// fs.go, which call into directoryVolume via DefaultVolume().
+type directoryVolume struct{}
+
+// volumeReaderAt is directoryVolume's VolumeReaderAt implementation.
+//
+// It records IO errors and successes against its device itself, since it's
+// the only layer that observes the outcome of the raw read syscall.
+type volumeReaderAt struct {
+	f      *os.File
+	device string
+}
+
+func (r *volumeReaderAt) ReadAt(p []byte, off int64) error {
+	if len(p) == 0 {
+		return nil
+	}
+	n, err := r.f.ReadAt(p, off)
+	if err != nil {
+		recordIOErrorDevice(r.device, err)
+		return fmt.Errorf("cannot read %d bytes at offset %d of file %q: %w", len(p), off, r.f.Name(), err)
+	}
+	if n != len(p) {
+		logger.Panicf("BUG: unexpected number of bytes read; got %d; want %d", n, len(p))
+	}
+	recordIOSuccessDevice(r.device)
+	return nil
+}
+
+func (r *volumeReaderAt) MustClose() {
+	if err := r.f.Close(); err != nil {
+		logger.Panicf("FATAL: cannot close file %q: %s", r.f.Name(), err)
+	}
+}
+
+func (dv *directoryVolume) OpenReaderAt(path string) (VolumeReaderAt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &volumeReaderAt{f: f, device: DeviceID(path)}, nil
+}
+
+var tmpFileNum uint64
+
+func (dv *directoryVolume) WriteAtomically(path string, data []byte) error {
+	n := atomic.AddUint64(&tmpFileNum, 1)
+	tmpPath := fmt.Sprintf("%s.tmp.%d", path, n)
+	f, err := filestream.Create(tmpPath, false)
+	if err != nil {
+		return fmt.Errorf("cannot create file %q: %s", tmpPath, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.MustClose()
+		MustRemoveAll(tmpPath)
+		return fmt.Errorf("cannot write %d bytes to file %q: %s", len(data), tmpPath, err)
+	}
+	f.MustClose()
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("cannot move %q to %q: %s", tmpPath, path, err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("cannot obtain absolute path to %q: %s", path, err)
+	}
+	parentDirPath := filepath.Dir(absPath)
+	MustSyncPath(parentDirPath)
+	return nil
+}
+
+func (dv *directoryVolume) Remove(path string) {
+	startTime := time.Now()
+	sleepTime := 100 * time.Millisecond
+again:
+	err := os.RemoveAll(path)
+	if err == nil {
+		mustSyncParentDirIfExists(path)
+		return
+	}
+	if !isTemporaryNFSError(err) {
+		logger.Panicf("FATAL: cannot remove %q: %s", path, err)
+	}
+	nfsDirRemoveFailedAttempts.Inc()
+	if time.Since(startTime) > time.Minute {
+		logger.Panicf("FATAL: couldn't remove NFS directory %q in %s", path, time.Minute)
+	}
+	time.Sleep(sleepTime)
+	sleepTime *= 2
+	if sleepTime > time.Second {
+		sleepTime = time.Second
+	}
+	goto again
+}
+
+func (dv *directoryVolume) HardLink(srcPath, dstPath string) error {
+	return os.Link(srcPath, dstPath)
+}
+
+func (dv *directoryVolume) Stat(path string) (uint64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(fi.Size()), nil
+}
+
+func (dv *directoryVolume) FreeSpace(path string) uint64 {
+	d, err := os.Open(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot determine free disk space on %q: %s", path, err)
+	}
+	defer MustClose(d)
+	fd := d.Fd()
+	var stat unix.Statfs_t
+	if err := unix.Fstatfs(int(fd), &stat); err != nil {
+		logger.Panicf("FATAL: cannot determine free disk space on %q: %s", path, err)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize)
+}
+
+func (dv *directoryVolume) Lock(dir string) (*os.File, error) {
+	flockFile := dir + "/flock.lock"
+	flockF, err := os.Create(flockFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create lock file %q: %s", flockFile, err)
+	}
+	if err := unix.Flock(int(flockF.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		return nil, fmt.Errorf("cannot acquire lock on file %q: %s", flockFile, err)
+	}
+	return flockF, nil
+}
@@ -0,0 +1,65 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectoryVolumeWriteReadRemove(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.bin")
+	data := []byte("some test data")
+
+	dv := &directoryVolume{}
+	if err := dv.WriteAtomically(path, data); err != nil {
+		t.Fatalf("WriteAtomically failed: %s", err)
+	}
+
+	size, err := dv.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %s", err)
+	}
+	if size != uint64(len(data)) {
+		t.Fatalf("unexpected size; got %d; want %d", size, len(data))
+	}
+
+	ra, err := dv.OpenReaderAt(path)
+	if err != nil {
+		t.Fatalf("OpenReaderAt failed: %s", err)
+	}
+	got := make([]byte, len(data))
+	if err := ra.ReadAt(got, 0); err != nil {
+		t.Fatalf("ReadAt failed: %s", err)
+	}
+	ra.MustClose()
+	if string(got) != string(data) {
+		t.Fatalf("unexpected data read; got %q; want %q", got, data)
+	}
+
+	dv.Remove(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected %q to be removed, got err=%v", path, err)
+	}
+}
+
+func TestDirectoryVolumeHardLink(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.bin")
+	dstPath := filepath.Join(dir, "dst.bin")
+	if err := os.WriteFile(srcPath, []byte("hi"), 0644); err != nil {
+		t.Fatalf("cannot write src file: %s", err)
+	}
+
+	dv := &directoryVolume{}
+	if err := dv.HardLink(srcPath, dstPath); err != nil {
+		t.Fatalf("HardLink failed: %s", err)
+	}
+	data, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatalf("cannot read dst file: %s", err)
+	}
+	if string(data) != "hi" {
+		t.Fatalf("unexpected dst contents; got %q; want %q", data, "hi")
+	}
+}
@@ -7,64 +7,89 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-	"sync/atomic"
-	"time"
 
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/filestream"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/metrics"
-	"golang.org/x/sys/unix"
 )
 
 // ReadAtCloser is rand-access read interface.
 type ReadAtCloser interface {
-	// ReadAt must read len(p) bytes from offset off to p.
-	ReadAt(p []byte, off int64)
+	// ReadAt must read len(p) bytes from offset off to p, returning an
+	// error on an IO failure instead of panicking.
+	ReadAt(p []byte, off int64) error
 
 	// MustClose must close the reader.
 	MustClose()
 }
 
-// ReaderAt implements rand-access read.
+// ReaderAt implements rand-access read via the configured Volume.
 type ReaderAt struct {
-	f *os.File
+	vra VolumeReaderAt
+	// device is resolved once in OpenReaderAt and reused on every ReadAt, so
+	// the hot read path doesn't have to re-derive it from a path via
+	// DeviceID (a stat plus a directory and mountinfo scan) on every call.
+	device string
+	dm     *deviceMetrics
 }
 
 // ReadAt reads len(p) bytes from off to p.
-func (ra *ReaderAt) ReadAt(p []byte, off int64) {
+//
+// It returns ErrDiskFaulty without touching the disk if ra's device has been
+// quarantined (by this read or a concurrent one) after too many consecutive
+// IO errors, instead of panicking on every failing read.
+func (ra *ReaderAt) ReadAt(p []byte, off int64) error {
 	if len(p) == 0 {
-		return
+		return nil
 	}
-	n, err := ra.f.ReadAt(p, off)
-	if err != nil {
-		logger.Panicf("FATAL: cannot read %d bytes at offset %d of file %q: %s", len(p), off, ra.f.Name(), err)
+	if !isHealthyDevice(ra.device) {
+		return ErrDiskFaulty
 	}
-	if n != len(p) {
-		logger.Panicf("FATAL: unexpected number of bytes read; got %d; want %d", n, len(p))
+	release := acquireIODevice(ra.device)
+	defer release()
+
+	if err := ra.vra.ReadAt(p, off); err != nil {
+		return err
 	}
+
 	readCalls.Inc()
 	readBytes.Add(len(p))
+	ra.dm.readCalls.Inc()
+	ra.dm.readBytes.Add(len(p))
+	return nil
 }
 
 // MustClose closes ra.
 func (ra *ReaderAt) MustClose() {
-	if err := ra.f.Close(); err != nil {
-		logger.Panicf("FATAL: cannot close file %q: %s", ra.f.Name(), err)
-	}
+	ra.vra.MustClose()
 	readersCount.Dec()
+	ra.dm.readersCount.Dec()
 }
 
-// OpenReaderAt opens a file on the given path for random-read access.
+// OpenReaderAt opens a file on the given path for random-read access via
+// the configured Volume (DefaultVolume by default).
 //
 // The file must be closed with MustClose when no longer needed.
+//
+// It returns ErrDiskFaulty without touching the disk if path's volume has
+// been quarantined after too many consecutive IO errors.
 func OpenReaderAt(path string) (*ReaderAt, error) {
-	f, err := os.Open(path)
+	device := DeviceID(path)
+	if !isHealthyDevice(device) {
+		return nil, ErrDiskFaulty
+	}
+	vra, err := DefaultVolume().OpenReaderAt(path)
 	if err != nil {
+		recordIOErrorDevice(device, err)
 		return nil, err
 	}
+	recordIOSuccessDevice(device)
 	readersCount.Inc()
+	dm := metricsForDevice(device)
+	dm.readersCount.Inc()
 	ra := &ReaderAt{
-		f: f,
+		vra:    vra,
+		device: device,
+		dm:     dm,
 	}
 	return ra, nil
 }
@@ -90,51 +115,38 @@ func MustSyncPath(path string) {
 	}
 }
 
-var tmpFileNum uint64
-
-// WriteFileAtomically atomically writes data to the given file path.
+// WriteFileAtomically atomically writes data to the given file path via the
+// configured Volume (DefaultVolume by default).
 //
 // WriteFileAtomically returns only after the file is fully written and synced
 // to the underlying storage.
+//
+// It returns ErrDiskFaulty without touching the disk if path's volume has
+// been quarantined after too many consecutive IO errors.
 func WriteFileAtomically(path string, data []byte) error {
+	if !IsHealthy(path) {
+		return ErrDiskFaulty
+	}
+
 	// Check for the existing file. It is expected that
 	// the WriteFileAtomically function cannot be called concurrently
 	// with the same `path`.
 	if IsPathExist(path) {
 		return fmt.Errorf("cannot create file %q, since it already exists", path)
 	}
-
-	n := atomic.AddUint64(&tmpFileNum, 1)
-	tmpPath := fmt.Sprintf("%s.tmp.%d", path, n)
-	f, err := filestream.Create(tmpPath, false)
-	if err != nil {
-		return fmt.Errorf("cannot create file %q: %s", tmpPath, err)
+	if err := Reserve(path, uint64(len(data))); err != nil {
+		return fmt.Errorf("cannot write file %q: %w", path, err)
 	}
-	if _, err := f.Write(data); err != nil {
-		f.MustClose()
-		MustRemoveAll(tmpPath)
-		return fmt.Errorf("cannot write %d bytes to file %q: %s", len(data), tmpPath, err)
-	}
-
-	// Sync and close the file.
-	f.MustClose()
 
-	// Atomically move the file from tmpPath to path.
-	if err := os.Rename(tmpPath, path); err != nil {
-		// do not call MustRemoveAll(tmpPath) here, so the user could inspect
-		// the file contents during investigating the issue.
-		return fmt.Errorf("cannot move %q to %q: %s", tmpPath, path, err)
-	}
+	release := acquireIO(path)
+	defer release()
 
-	// Sync the containing directory, so the file is guaranteed to appear in the directory.
-	// See https://www.quora.com/When-should-you-fsync-the-containing-directory-in-addition-to-the-file-itself
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return fmt.Errorf("cannot obtain absolute path to %q: %s", path, err)
+	if err := DefaultVolume().WriteAtomically(path, data); err != nil {
+		recordIOError(path, err)
+		return err
 	}
-	parentDirPath := filepath.Dir(absPath)
-	MustSyncPath(parentDirPath)
 
+	recordIOSuccess(path)
 	return nil
 }
 
@@ -244,42 +256,12 @@ func mustSyncParentDirIfExists(path string) {
 	MustSyncPath(parentDirPath)
 }
 
-// MustRemoveAll removes path with all the contents.
+// MustRemoveAll removes path with all the contents via the configured Volume
+// (DefaultVolume by default).
 //
 // It properly handles NFS issue https://github.com/VictoriaMetrics/VictoriaMetrics/issues/61 .
 func MustRemoveAll(path string) {
-	startTime := time.Now()
-	sleepTime := 100 * time.Millisecond
-again:
-	err := os.RemoveAll(path)
-	if err == nil {
-		// Make sure the parent directory doesn't contain references
-		// to the current directory.
-		mustSyncParentDirIfExists(path)
-		return
-	}
-	if !isTemporaryNFSError(err) {
-		logger.Panicf("FATAL: cannot remove %q: %s", path, err)
-	}
-	// NFS prevents from removing directories with open files.
-	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/61 .
-	// Continuously try removing the directory for up to a minute before giving up.
-	//
-	// Do not postpone directory removal, since it breaks in the following case:
-	// - Remove the directory (the removal is postponed)
-	// - Scan for exsiting directories and open them. The scan finds
-	//   the `removed` directory, but its contents may be already broken.
-	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/162 .
-	nfsDirRemoveFailedAttempts.Inc()
-	if time.Since(startTime) > time.Minute {
-		logger.Panicf("FATAL: couldn't remove NFS directory %q in %s", path, time.Minute)
-	}
-	time.Sleep(sleepTime)
-	sleepTime *= 2
-	if sleepTime > time.Second {
-		sleepTime = time.Second
-	}
-	goto again
+	DefaultVolume().Remove(path)
 }
 
 var nfsDirRemoveFailedAttempts = metrics.NewCounter(`vm_nfs_dir_remove_failed_attempts_total`)
@@ -290,14 +272,27 @@ func isTemporaryNFSError(err error) bool {
 	return strings.Contains(errStr, "directory not empty") || strings.Contains(errStr, "device or resource busy")
 }
 
-// HardLinkFiles makes hard links for all the files from srcDir in dstDir.
+// HardLinkFiles makes hard links for all the files from srcDir in dstDir via
+// the configured Volume (DefaultVolume by default).
+//
+// It returns ErrDiskFaulty without touching the disk if srcDir's volume has
+// been quarantined after too many consecutive IO errors.
 func HardLinkFiles(srcDir, dstDir string) error {
+	if !IsHealthy(srcDir) {
+		return ErrDiskFaulty
+	}
+
+	release := acquireIO(srcDir)
+	defer release()
+
 	if err := mkdirSync(dstDir); err != nil {
+		recordIOError(srcDir, err)
 		return fmt.Errorf("cannot create dstDir=%q: %s", dstDir, err)
 	}
 
 	d, err := os.Open(srcDir)
 	if err != nil {
+		recordIOError(srcDir, err)
 		return fmt.Errorf("cannot open srcDir=%q: %s", srcDir, err)
 	}
 	defer func() {
@@ -308,8 +303,10 @@ func HardLinkFiles(srcDir, dstDir string) error {
 
 	fis, err := d.Readdir(-1)
 	if err != nil {
+		recordIOError(srcDir, err)
 		return fmt.Errorf("cannot read files in scrDir=%q: %s", srcDir, err)
 	}
+	vol := DefaultVolume()
 	for _, fi := range fis {
 		if IsDirOrSymlink(fi) {
 			// Skip directories.
@@ -318,11 +315,13 @@ func HardLinkFiles(srcDir, dstDir string) error {
 		fn := fi.Name()
 		srcPath := srcDir + "/" + fn
 		dstPath := dstDir + "/" + fn
-		if err := os.Link(srcPath, dstPath); err != nil {
+		if err := vol.HardLink(srcPath, dstPath); err != nil {
+			recordIOError(srcDir, err)
 			return err
 		}
 	}
 
+	recordIOSuccess(srcDir)
 	MustSyncPath(dstDir)
 	return nil
 }
@@ -371,33 +370,15 @@ func MustWriteData(w io.Writer, data []byte) {
 	}
 }
 
-// CreateFlockFile creates flock.lock file in the directory dir
-// and returns the handler to the file.
+// CreateFlockFile creates flock.lock file in the directory dir via the
+// configured Volume (DefaultVolume by default) and returns the handler to
+// the file.
 func CreateFlockFile(dir string) (*os.File, error) {
-	flockFile := dir + "/flock.lock"
-	flockF, err := os.Create(flockFile)
-	if err != nil {
-		return nil, fmt.Errorf("cannot create lock file %q: %s", flockFile, err)
-	}
-	if err := unix.Flock(int(flockF.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
-		return nil, fmt.Errorf("cannot acquire lock on file %q: %s", flockFile, err)
-	}
-	return flockF, nil
+	return DefaultVolume().Lock(dir)
 }
 
-// MustGetFreeSpace returns free space for the given directory path.
+// MustGetFreeSpace returns free space for the given directory path via the
+// configured Volume (DefaultVolume by default).
 func MustGetFreeSpace(path string) uint64 {
-	d, err := os.Open(path)
-	if err != nil {
-		logger.Panicf("FATAL: cannot determine free disk space on %q: %s", path, err)
-	}
-	defer MustClose(d)
-
-	fd := d.Fd()
-	var stat unix.Statfs_t
-	if err := unix.Fstatfs(int(fd), &stat); err != nil {
-		logger.Panicf("FATAL: cannot determine free disk space on %q: %s", path, err)
-	}
-	freeSpace := uint64(stat.Bavail) * uint64(stat.Bsize)
-	return freeSpace
+	return DefaultVolume().FreeSpace(path)
 }
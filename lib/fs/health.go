@@ -0,0 +1,132 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// ErrDiskFaulty is returned by OpenReaderAt, WriteFileAtomically and
+// HardLinkFiles once their underlying volume has been quarantined after too
+// many consecutive IO errors.
+var ErrDiskFaulty = errors.New("disk is quarantined after too many consecutive IO errors")
+
+// DefaultMaxConsecutiveIOErrors is the default number of consecutive IO
+// errors a volume tolerates before being quarantined.
+const DefaultMaxConsecutiveIOErrors = 5
+
+// volumeHealth tracks consecutive IO errors for a single volume (keyed by
+// DeviceID), so a failing spindle can be quarantined without panicking
+// through the whole process while other volumes keep serving.
+type volumeHealth struct {
+	device             string
+	maxConsecutiveErrs int64
+	consecutiveErrs    int64 // atomic
+	unhealthy          int32 // atomic bool: 0 healthy, 1 unhealthy
+
+	healthGauge *metrics.Gauge
+}
+
+var (
+	healthMu sync.Mutex
+	healthM  = make(map[string]*volumeHealth)
+
+	// transitionCh carries quarantine/recovery transitions to the supervisor
+	// goroutine, which just logs them.
+	transitionCh = make(chan string, 100)
+)
+
+func init() {
+	go func() {
+		for msg := range transitionCh {
+			logger.Warnf("%s", msg)
+		}
+	}()
+}
+
+// healthFor returns the volumeHealth tracker for path's device, creating it
+// on first use with the default error threshold.
+func healthFor(path string) *volumeHealth {
+	return healthForDevice(DeviceID(path))
+}
+
+// healthForDevice is the device-keyed counterpart of healthFor. Hot paths
+// that already know their device (e.g. ReaderAt, which resolves and caches
+// it once on open) should call this directly instead of re-deriving the
+// device from a path on every call.
+func healthForDevice(device string) *volumeHealth {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	vh, ok := healthM[device]
+	if ok {
+		return vh
+	}
+	vh = &volumeHealth{
+		device:             device,
+		maxConsecutiveErrs: DefaultMaxConsecutiveIOErrors,
+	}
+	vh.healthGauge = metrics.GetOrCreateGauge(fmt.Sprintf(`vm_fs_disk_health{path=%q}`, device), func() float64 {
+		if atomic.LoadInt32(&vh.unhealthy) != 0 {
+			return 0
+		}
+		return 1
+	})
+	healthM[device] = vh
+	return vh
+}
+
+// SetIOErrorThreshold overrides the number of consecutive IO errors path's
+// volume tolerates before being quarantined.
+func SetIOErrorThreshold(path string, n int64) {
+	vh := healthFor(path)
+	atomic.StoreInt64(&vh.maxConsecutiveErrs, n)
+}
+
+// IsHealthy returns whether path's volume hasn't been quarantined.
+func IsHealthy(path string) bool {
+	vh := healthFor(path)
+	return atomic.LoadInt32(&vh.unhealthy) == 0
+}
+
+// recordIOSuccess resets path's volume's consecutive error counter and lifts
+// its quarantine, if any.
+func recordIOSuccess(path string) {
+	recordIOSuccessDevice(DeviceID(path))
+}
+
+// recordIOError increments path's volume's consecutive error counter,
+// quarantining the volume once it exceeds the configured threshold.
+func recordIOError(path string, err error) {
+	recordIOErrorDevice(DeviceID(path), err)
+}
+
+// recordIOSuccessDevice is the device-keyed counterpart of recordIOSuccess.
+// Hot paths that already know their device should call this directly
+// instead of re-deriving the device from a path on every call.
+func recordIOSuccessDevice(device string) {
+	vh := healthForDevice(device)
+	atomic.StoreInt64(&vh.consecutiveErrs, 0)
+	if atomic.CompareAndSwapInt32(&vh.unhealthy, 1, 0) {
+		transitionCh <- fmt.Sprintf("fs: volume for device %q has recovered and is no longer quarantined", device)
+	}
+}
+
+// recordIOErrorDevice is the device-keyed counterpart of recordIOError.
+func recordIOErrorDevice(device string, err error) {
+	vh := healthForDevice(device)
+	n := atomic.AddInt64(&vh.consecutiveErrs, 1)
+	threshold := atomic.LoadInt64(&vh.maxConsecutiveErrs)
+	if n > threshold && atomic.CompareAndSwapInt32(&vh.unhealthy, 0, 1) {
+		transitionCh <- fmt.Sprintf("fs: quarantining device %q after %d consecutive IO errors; last error: %s", device, n, err)
+	}
+}
+
+// isHealthyDevice is the device-keyed counterpart of IsHealthy.
+func isHealthyDevice(device string) bool {
+	vh := healthForDevice(device)
+	return atomic.LoadInt32(&vh.unhealthy) == 0
+}
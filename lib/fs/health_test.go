@@ -0,0 +1,29 @@
+package fs
+
+import "testing"
+
+func TestHealthQuarantineAndRecover(t *testing.T) {
+	dir := t.TempDir()
+	SetIOErrorThreshold(dir, 3)
+
+	if !IsHealthy(dir) {
+		t.Fatalf("expected %q to be healthy initially", dir)
+	}
+
+	fakeErr := errString("boom")
+	for i := 0; i < 4; i++ {
+		recordIOError(dir, fakeErr)
+	}
+	if IsHealthy(dir) {
+		t.Fatalf("expected %q to be quarantined after exceeding the error threshold", dir)
+	}
+
+	recordIOSuccess(dir)
+	if !IsHealthy(dir) {
+		t.Fatalf("expected %q to recover after a successful IO", dir)
+	}
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
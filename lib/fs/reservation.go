@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// ErrDiskFull is returned by Reserve and WriteFileAtomically when fulfilling
+// the request would drop a registered mountpoint below its reservation.
+var ErrDiskFull = errors.New("not enough free disk space")
+
+// defaultMinFreeSpace is the default minimum free-space reservation applied
+// to a mountpoint registered without an explicit threshold.
+const defaultMinFreeSpace = 1 << 30 // 1GiB
+
+// statfsRefreshInterval is how often a registered mountpoint's free space
+// is re-read from the OS.
+const statfsRefreshInterval = 5 * time.Second
+
+// reservation tracks the minimum free-space threshold for a single
+// registered mountpoint, plus a periodically refreshed cache of its actual
+// free space so Reserve doesn't need to call statfs on every write.
+type reservation struct {
+	path      string
+	minFree   uint64
+	freeBytes uint64 // accessed only while holding reservationsMu
+
+	freeGauge    *metrics.Gauge
+	rejectsTotal *metrics.Counter
+}
+
+var (
+	reservationsMu sync.Mutex
+	reservations   = make(map[string]*reservation)
+)
+
+// RegisterReservation registers path as a mountpoint that must always keep
+// at least minFreeSpace bytes free. If minFreeSpace is 0, defaultMinFreeSpace
+// is used.
+//
+// The reservation's free-space cache is refreshed every statfsRefreshInterval
+// by a background goroutine for the lifetime of the process.
+func RegisterReservation(path string, minFreeSpace uint64) {
+	if minFreeSpace == 0 {
+		minFreeSpace = defaultMinFreeSpace
+	}
+
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	if _, ok := reservations[path]; ok {
+		return
+	}
+	r := &reservation{
+		path:      path,
+		minFree:   minFreeSpace,
+		freeBytes: MustGetFreeSpace(path),
+	}
+	r.freeGauge = metrics.GetOrCreateGauge(fmt.Sprintf(`vm_fs_free_bytes{path=%q}`, path), func() float64 {
+		reservationsMu.Lock()
+		defer reservationsMu.Unlock()
+		return float64(r.freeBytes)
+	})
+	r.rejectsTotal = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_fs_reservation_rejects_total{path=%q}`, path))
+	reservations[path] = r
+	go r.refreshLoop()
+}
+
+func (r *reservation) refreshLoop() {
+	t := time.NewTicker(statfsRefreshInterval)
+	defer t.Stop()
+	for range t.C {
+		free := MustGetFreeSpace(r.path)
+		reservationsMu.Lock()
+		r.freeBytes = free
+		reservationsMu.Unlock()
+	}
+}
+
+// Reserve checks whether writing nbytes more to path's mountpoint would drop
+// it below its registered reservation, returning ErrDiskFull if so.
+//
+// It is a no-op if path's mountpoint hasn't been registered via
+// RegisterReservation.
+func Reserve(path string, nbytes uint64) error {
+	r := reservationFor(path)
+	if r == nil {
+		return nil
+	}
+	reservationsMu.Lock()
+	free := r.freeBytes
+	reservationsMu.Unlock()
+	if free < r.minFree+nbytes {
+		r.rejectsTotal.Inc()
+		return fmt.Errorf("%w: only %d bytes free at %q, need to keep %d bytes reserved plus write %d bytes", ErrDiskFull, free, r.path, r.minFree, nbytes)
+	}
+	return nil
+}
+
+// reservationFor returns the registered reservation whose path is the
+// longest prefix of the given path, or nil if none is registered.
+func reservationFor(path string) *reservation {
+	reservationsMu.Lock()
+	defer reservationsMu.Unlock()
+	var best *reservation
+	for _, r := range reservations {
+		if !isSubPath(r.path, path) {
+			continue
+		}
+		if best == nil || len(r.path) > len(best.path) {
+			best = r
+		}
+	}
+	return best
+}
+
+func isSubPath(mount, path string) bool {
+	if path == mount {
+		return true
+	}
+	return len(path) > len(mount) && path[:len(mount)] == mount && path[len(mount)] == '/'
+}
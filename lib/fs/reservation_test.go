@@ -0,0 +1,22 @@
+package fs
+
+import "testing"
+
+func TestReserveUnregisteredPathIsNoop(t *testing.T) {
+	if err := Reserve("/some/path/never/registered", 1<<40); err != nil {
+		t.Fatalf("unexpected error for unregistered path: %s", err)
+	}
+}
+
+func TestIsSubPath(t *testing.T) {
+	f := func(mount, path string, want bool) {
+		t.Helper()
+		if got := isSubPath(mount, path); got != want {
+			t.Fatalf("isSubPath(%q, %q) = %v; want %v", mount, path, got, want)
+		}
+	}
+	f("/data", "/data", true)
+	f("/data", "/data/foo", true)
+	f("/data", "/data-other", false)
+	f("/data", "/other", false)
+}
@@ -0,0 +1,251 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"golang.org/x/sys/unix"
+)
+
+// SafeRoot confines all path resolution to a single directory tree, so a
+// symlink planted inside it (e.g. by a rogue tenant sharing the parent data
+// directory) can't be used to escape to files outside the tree.
+//
+// It opens the root directory once, and every subsequent operation resolves
+// the confined portion of its path relative to that anchor fd via openat2
+// with RESOLVE_BENEATH (or an intermediate fd opened the same way),
+// keeping the fd open for the duration of the I/O instead of just checking
+// it once - see openParentBeneath - so a TOCTOU swap of an intermediate
+// directory mid-operation can't redirect it outside root either.
+type SafeRoot struct {
+	root   string
+	rootFd int
+}
+
+// openat2Supported caches whether the running kernel supports openat2(2).
+// It is probed once, on first use, against "/".
+var openat2Supported atomic.Value // bool
+
+func isOpenat2Supported() bool {
+	if v := openat2Supported.Load(); v != nil {
+		return v.(bool)
+	}
+	fd, err := unix.Openat2(unix.AT_FDCWD, "/", &unix.OpenHow{
+		Flags: unix.O_RDONLY | unix.O_DIRECTORY,
+		Mode:  0,
+	})
+	if err == nil {
+		_ = unix.Close(fd)
+	}
+	supported := err != unix.ENOSYS
+	openat2Supported.Store(supported)
+	return supported
+}
+
+// NewSafeRoot opens root and returns a SafeRoot anchored at it.
+//
+// The returned SafeRoot must be closed with MustClose when no longer needed.
+func NewSafeRoot(root string) (*SafeRoot, error) {
+	fd, err := unix.Open(root, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open root directory %q: %w", root, err)
+	}
+	return &SafeRoot{
+		root:   root,
+		rootFd: fd,
+	}, nil
+}
+
+// MustClose closes sr.
+func (sr *SafeRoot) MustClose() {
+	if err := unix.Close(sr.rootFd); err != nil {
+		logger.Panicf("FATAL: cannot close root directory %q: %s", sr.root, err)
+	}
+}
+
+// openBeneath opens relPath relative to dirFd, refusing to resolve outside
+// of it - via openat2(RESOLVE_BENEATH|RESOLVE_NO_SYMLINKS|RESOLVE_NO_MAGICLINKS)
+// when the kernel supports it, falling back to openat+O_NOFOLLOW plus an
+// explicit lexical prefix check otherwise.
+func openBeneath(dirFd int, relPath string, flags int) (int, error) {
+	if isOpenat2Supported() {
+		fd, err := unix.Openat2(dirFd, relPath, &unix.OpenHow{
+			Flags:   uint64(flags) | unix.O_RDONLY,
+			Mode:    0,
+			Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return fd, nil
+	}
+	return openBeneathFallback(dirFd, relPath, flags)
+}
+
+// openBeneathFallback is used on kernels without openat2(2) support.
+//
+// It rejects any relPath that escapes the anchor lexically (via ".." or an
+// absolute path) and opens with O_NOFOLLOW, so at least the final path
+// component can't be a symlink. It is weaker than openBeneath against
+// concurrent renames of intermediate directories, but that's an accepted
+// trade-off on old kernels.
+func openBeneathFallback(dirFd int, relPath string, flags int) (int, error) {
+	clean := filepath.Clean(relPath)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return 0, fmt.Errorf("path %q escapes the confined root", relPath)
+	}
+	return unix.Openat(dirFd, clean, flags|unix.O_NOFOLLOW, 0)
+}
+
+// path returns the absolute path of relPath for use in error messages only;
+// it must never be passed to an actual I/O syscall, since re-walking it from
+// "/" would reopen the TOCTOU window openBeneath/openParentBeneath exist to
+// close.
+func (sr *SafeRoot) path(relPath string) string {
+	return filepath.Join(sr.root, relPath)
+}
+
+// ReadAt reads len(p) bytes at offset off from relPath, confined to sr.
+func (sr *SafeRoot) ReadAt(relPath string, p []byte, off int64) error {
+	fd, err := openBeneath(sr.rootFd, relPath, unix.O_RDONLY)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", sr.path(relPath), err)
+	}
+	f := os.NewFile(uintptr(fd), sr.path(relPath))
+	defer f.Close()
+	if _, err := f.ReadAt(p, off); err != nil {
+		return fmt.Errorf("cannot read %d bytes at offset %d of %q: %w", len(p), off, sr.path(relPath), err)
+	}
+	return nil
+}
+
+// WriteFileAtomically atomically writes data to relPath, confined to sr.
+//
+// The temp file used for the atomic write is created via an fd-relative
+// openat(parentFd, ..., O_CREAT|O_EXCL|O_NOFOLLOW) rather than handed off to
+// the unconfined, path-based package-level WriteFileAtomically. Otherwise a
+// symlink planted at the predictable "<leaf>.tmp.<N>" name (directoryVolume's
+// tmpFileNum is a process-global monotonic counter) could redirect the write
+// outside of sr - the same TOCTOU class openParentBeneath already closes for
+// this package's other operations.
+func (sr *SafeRoot) WriteFileAtomically(relPath string, data []byte) error {
+	parentFd, leaf, closeFd, err := sr.openParentBeneath(relPath)
+	if err != nil {
+		return err
+	}
+	defer closeFd()
+
+	dstPath := sr.path(relPath)
+	if IsPathExist(confinedPath(parentFd, leaf)) {
+		return fmt.Errorf("cannot create file %q, since it already exists", dstPath)
+	}
+
+	n := atomic.AddUint64(&tmpFileNum, 1)
+	tmpName := fmt.Sprintf("%s.tmp.%d", leaf, n)
+	fd, err := unix.Openat(parentFd, tmpName, unix.O_CREAT|unix.O_EXCL|unix.O_NOFOLLOW|unix.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file for %q: %w", dstPath, err)
+	}
+	tmpFile := os.NewFile(uintptr(fd), confinedPath(parentFd, tmpName))
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		_ = unix.Unlinkat(parentFd, tmpName, 0)
+		return fmt.Errorf("cannot write %d bytes to temporary file for %q: %w", len(data), dstPath, err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		_ = unix.Unlinkat(parentFd, tmpName, 0)
+		return fmt.Errorf("cannot sync temporary file for %q: %w", dstPath, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = unix.Unlinkat(parentFd, tmpName, 0)
+		return fmt.Errorf("cannot close temporary file for %q: %w", dstPath, err)
+	}
+	if err := unix.Renameat(parentFd, tmpName, parentFd, leaf); err != nil {
+		return fmt.Errorf("cannot move temporary file into place at %q: %w", dstPath, err)
+	}
+	if err := unix.Fsync(parentFd); err != nil {
+		return fmt.Errorf("cannot flush parent directory of %q to storage: %w", dstPath, err)
+	}
+	return nil
+}
+
+// MkdirAll creates relPath, confined to sr.
+func (sr *SafeRoot) MkdirAll(relPath string) error {
+	parentFd, leaf, closeFd, err := sr.openParentBeneath(relPath)
+	if err != nil {
+		return err
+	}
+	defer closeFd()
+	return MkdirAllIfNotExist(confinedPath(parentFd, leaf))
+}
+
+// RemoveAll removes relPath with all of its contents, confined to sr.
+func (sr *SafeRoot) RemoveAll(relPath string) {
+	parentFd, leaf, closeFd, err := sr.openParentBeneath(relPath)
+	if err != nil {
+		logger.Panicf("FATAL: %s", err)
+	}
+	defer closeFd()
+	MustRemoveAll(confinedPath(parentFd, leaf))
+}
+
+// HardLink creates a hard link for srcRelPath at dstRelPath, both confined to sr.
+func (sr *SafeRoot) HardLink(srcRelPath, dstRelPath string) error {
+	srcParentFd, srcLeaf, closeSrcFd, err := sr.openParentBeneath(srcRelPath)
+	if err != nil {
+		return err
+	}
+	defer closeSrcFd()
+	dstParentFd, dstLeaf, closeDstFd, err := sr.openParentBeneath(dstRelPath)
+	if err != nil {
+		return err
+	}
+	defer closeDstFd()
+	return os.Link(confinedPath(srcParentFd, srcLeaf), confinedPath(dstParentFd, dstLeaf))
+}
+
+// openParentBeneath resolves the parent directory of relPath via openBeneath
+// and returns it open, along with relPath's base name and a closer to call
+// once the caller is done with the fd.
+//
+// The fd is kept open (rather than closed right after the check, as an
+// earlier version of this code did) and the subsequent I/O is confined to
+// resolve exactly one path component - leaf - relative to it via
+// confinedPath, instead of re-walking the full path from "/". That's the
+// part that actually closes the TOCTOU window: if the parent were only
+// checked-then-closed, a rename/symlink swap of the parent directory between
+// the check and the later unconfined, path-based I/O call could still
+// redirect the operation outside of sr.
+func (sr *SafeRoot) openParentBeneath(relPath string) (parentFd int, leaf string, closeFd func(), err error) {
+	leaf = filepath.Base(relPath)
+	parent := filepath.Dir(relPath)
+	if parent == "." {
+		// relPath is a direct child of root; sr.rootFd is already held open
+		// and confined for the lifetime of sr, so there's nothing to resolve.
+		return sr.rootFd, leaf, func() {}, nil
+	}
+	fd, err := openBeneath(sr.rootFd, parent, unix.O_DIRECTORY)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("cannot confine %q beneath %q: %w", relPath, sr.root, err)
+	}
+	closeFd = func() {
+		if err := unix.Close(fd); err != nil {
+			logger.Panicf("FATAL: cannot close directory fd for %q: %s", sr.path(parent), err)
+		}
+	}
+	return fd, leaf, closeFd, nil
+}
+
+// confinedPath turns a directory fd plus a single path component into a
+// path that the os package (or any other path-based API) will resolve
+// relative to that fd rather than by re-walking the component's name from
+// "/", so holding parentFd open across the call is what confines the I/O -
+// not the string itself.
+func confinedPath(parentFd int, leaf string) string {
+	return fmt.Sprintf("/proc/self/fd/%d/%s", parentFd, leaf)
+}
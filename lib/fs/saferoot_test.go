@@ -0,0 +1,20 @@
+package fs
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestOpenBeneathFallbackRejectsEscape(t *testing.T) {
+	dir := t.TempDir()
+	anchorFd, err := unix.Open(dir, unix.O_DIRECTORY|unix.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("cannot open anchor dir: %s", err)
+	}
+	defer func() { _ = unix.Close(anchorFd) }()
+
+	if _, err := openBeneathFallback(anchorFd, "../etc/passwd", 0); err == nil {
+		t.Fatalf("expected an error when escaping the confined root, got none")
+	}
+}
@@ -0,0 +1,81 @@
+package fs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// ioLimiter serializes access to a single device's worth of IO via a
+// counting semaphore, so HDD-backed mounts can be configured to avoid
+// collapsing random-read throughput under concurrent access.
+type ioLimiter struct {
+	sem      chan struct{}
+	waitHist *metrics.Histogram
+}
+
+var (
+	ioLimitersMu sync.Mutex
+	ioLimiters   = make(map[string]*ioLimiter)
+)
+
+// SetIOConcurrency sets the maximum number of concurrent IO operations
+// allowed against devicePath's underlying device.
+//
+// n=1 serializes all IO for the device into a single queue, which can
+// roughly double effective throughput on spinning disks under concurrent
+// random access. n=0 (the default) applies no limit at all.
+func SetIOConcurrency(devicePath string, n int) {
+	device := DeviceID(devicePath)
+
+	ioLimitersMu.Lock()
+	defer ioLimitersMu.Unlock()
+	if n <= 0 {
+		delete(ioLimiters, device)
+		return
+	}
+	ioLimiters[device] = &ioLimiter{
+		sem:      make(chan struct{}, n),
+		waitHist: metrics.GetOrCreateHistogram(fmt.Sprintf(`vm_fs_io_queue_wait_seconds{path=%q}`, device)),
+	}
+}
+
+func limiterFor(path string) *ioLimiter {
+	return limiterForDevice(DeviceID(path))
+}
+
+func limiterForDevice(device string) *ioLimiter {
+	ioLimitersMu.Lock()
+	defer ioLimitersMu.Unlock()
+	return ioLimiters[device]
+}
+
+// acquireIO blocks until path's device has a free IO slot, if a limit has
+// been configured for it via SetIOConcurrency, and returns a function that
+// must be called to release the slot.
+//
+// If no limit has been configured, acquireIO returns immediately with a
+// no-op release function.
+func acquireIO(path string) (release func()) {
+	return acquireIODevice(DeviceID(path))
+}
+
+// acquireIODevice is the device-keyed counterpart of acquireIO. Hot paths
+// that already know their device (e.g. ReaderAt, which resolves and caches
+// it once on open) should call this directly instead of re-deriving the
+// device from a path on every call, since DeviceID involves a stat plus a
+// directory and mountinfo scan.
+func acquireIODevice(device string) (release func()) {
+	lim := limiterForDevice(device)
+	if lim == nil {
+		return func() {}
+	}
+	startTime := time.Now()
+	lim.sem <- struct{}{}
+	lim.waitHist.UpdateDuration(startTime)
+	return func() {
+		<-lim.sem
+	}
+}
@@ -0,0 +1,42 @@
+package fs
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireIOSerializesAccess(t *testing.T) {
+	dir := t.TempDir()
+	SetIOConcurrency(dir, 1)
+	defer SetIOConcurrency(dir, 0)
+
+	var inFlight int32
+	var maxInFlight int32
+	done := make(chan struct{})
+
+	for i := 0; i < 5; i++ {
+		go func() {
+			release := acquireIO(dir)
+			defer release()
+
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				old := atomic.LoadInt32(&maxInFlight)
+				if n <= old || atomic.CompareAndSwapInt32(&maxInFlight, old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+
+	if got := atomic.LoadInt32(&maxInFlight); got != 1 {
+		t.Fatalf("expected at most 1 concurrent IO operation with SetIOConcurrency(dir, 1); got %d", got)
+	}
+}
@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"os"
+	"sync"
+)
+
+// Volume abstracts the storage backend used for data and index directories.
+//
+// The default registered driver ("directory") operates on the local POSIX
+// filesystem exactly like the rest of this package always has, so existing
+// call sites keep working unmodified. Other drivers (e.g. an object-storage
+// backed volume for tiered cold data) can be registered via RegisterDriver
+// and selected with SetDefaultVolume, without touching the functions in this
+// package that route through DefaultVolume().
+type Volume interface {
+	// OpenReaderAt opens path for random-read access.
+	OpenReaderAt(path string) (VolumeReaderAt, error)
+
+	// WriteAtomically atomically writes data to path.
+	WriteAtomically(path string, data []byte) error
+
+	// Remove removes path with all of its contents, if it is a directory.
+	Remove(path string)
+
+	// HardLink creates a hard link for srcPath at dstPath.
+	HardLink(srcPath, dstPath string) error
+
+	// Stat returns the size in bytes of the file at path.
+	Stat(path string) (uint64, error)
+
+	// FreeSpace returns the free space available at path.
+	FreeSpace(path string) uint64
+
+	// Lock acquires an exclusive lock on the given directory and returns a
+	// handle that releases the lock on Close.
+	Lock(dir string) (*os.File, error)
+}
+
+// VolumeReaderAt is the Volume counterpart of ReaderAt.
+type VolumeReaderAt interface {
+	// ReadAt must read len(p) bytes from offset off to p, returning an
+	// error instead of panicking on an IO failure, so the caller can record
+	// it towards the owning device's quarantine threshold instead of taking
+	// down the whole process on the first disk hiccup.
+	ReadAt(p []byte, off int64) error
+	MustClose()
+}
+
+// VolumeFactory constructs a Volume. args carries driver-specific
+// configuration, e.g. a bucket name or connection string for a remote driver.
+type VolumeFactory func(args string) (Volume, error)
+
+var (
+	driversMu sync.Mutex
+	drivers   = make(map[string]VolumeFactory)
+)
+
+// RegisterDriver registers factory under the given name, so NewVolume(name, args)
+// can construct a Volume with it.
+//
+// RegisterDriver panics if name is already registered.
+func RegisterDriver(name string, factory VolumeFactory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, ok := drivers[name]; ok {
+		panic("BUG: driver " + name + " is already registered")
+	}
+	drivers[name] = factory
+}
+
+// NewVolume constructs a Volume using the driver registered under name.
+func NewVolume(name, args string) (Volume, error) {
+	driversMu.Lock()
+	factory, ok := drivers[name]
+	driversMu.Unlock()
+	if !ok {
+		return nil, &driverNotFoundError{name: name}
+	}
+	return factory(args)
+}
+
+type driverNotFoundError struct {
+	name string
+}
+
+func (e *driverNotFoundError) Error() string {
+	return "unknown fs volume driver: " + e.name
+}
+
+func init() {
+	RegisterDriver("directory", func(string) (Volume, error) {
+		return &directoryVolume{}, nil
+	})
+}
+
+// defaultVolumeMu protects defaultVolume.
+var defaultVolumeMu sync.RWMutex
+var defaultVolume Volume = &directoryVolume{}
+
+// DefaultVolume returns the Volume currently used by the package-level
+// functions in this package (WriteFileAtomically, MustRemoveAll, etc).
+func DefaultVolume() Volume {
+	defaultVolumeMu.RLock()
+	v := defaultVolume
+	defaultVolumeMu.RUnlock()
+	return v
+}
+
+// SetDefaultVolume overrides the Volume used by the package-level functions
+// in this package. It is meant to be called once during startup.
+func SetDefaultVolume(v Volume) {
+	defaultVolumeMu.Lock()
+	defaultVolume = v
+	defaultVolumeMu.Unlock()
+}